@@ -0,0 +1,137 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/migrate"
+	"DotaReplays/migrations"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const healthTimeout = 5 * time.Second
+
+// errUnhealthy is returned once health has reported a failed check, so that
+// admin exits with status 1 without reporting anything further.
+var errUnhealthy = errors.New("unhealthy")
+
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// health runs every check, even after one fails, so that a single run shows
+// everything that is wrong. A dead job is a warning: the system is working,
+// but someone should look at it.
+func (a *admin) health(args []string) error {
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	api := fs.String("api", "", "")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	checks := []check{a.checkDatabase()}
+	if checks[0].Status == "ok" {
+		checks = append(checks, a.checkMigrations(), a.checkJobs())
+	}
+	if *api != "" {
+		checks = append(checks, checkAPI(*api))
+	}
+	healthy := true
+	for _, c := range checks {
+		healthy = healthy && c.Status != "fail"
+	}
+	status := "ok"
+	if !healthy {
+		status = "fail"
+	}
+	err = a.print(map[string]any{"status": status, "checks": checks}, func(w io.Writer) {
+		for _, c := range checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, strings.ToUpper(c.Status), c.Detail)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !healthy {
+		return errUnhealthy
+	}
+	return nil
+}
+
+func newCheck(name string, err error, detail string) check {
+	if err != nil {
+		return check{Name: name, Status: "fail", Detail: err.Error()}
+	}
+	return check{Name: name, Status: "ok", Detail: detail}
+}
+
+func (a *admin) checkDatabase() check {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	start := time.Now()
+	err := a.db.PingContext(ctx)
+	return newCheck("database", err, fmt.Sprintf("ping took %s", time.Since(start).Round(time.Millisecond)))
+}
+
+// checkMigrations fails if the schema is behind this build, as the API would
+// then run queries against tables or columns that do not exist yet.
+func (a *admin) checkMigrations() check {
+	mr, err := migrate.New(a.db, migrations.FS)
+	if err != nil {
+		return newCheck("migrations", err, "")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	statuses, err := mr.Status(ctx)
+	if err != nil {
+		return newCheck("migrations", err, "")
+	}
+	var pending []string
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, fmt.Sprintf("%06d", s.Version))
+		}
+	}
+	if len(pending) > 0 {
+		return newCheck("migrations", fmt.Errorf("%d pending: %s", len(pending), strings.Join(pending, ", ")), "")
+	}
+	return newCheck("migrations", nil, fmt.Sprintf("up to date at version %d", mr.Latest()))
+}
+
+func (a *admin) checkJobs() check {
+	filters := data.Filters{Page: 1, PageSize: 1, Sort: "id", SortSafelist: []string{"id"}}
+	_, metadata, err := a.models.Jobs.GetAll(data.JobDead, "", filters)
+	if err != nil {
+		return newCheck("jobs", err, "")
+	}
+	c := newCheck("jobs", nil, "no dead jobs")
+	if metadata.TotalRecords > 0 {
+		c.Status = "warn"
+		c.Detail = fmt.Sprintf("%d dead jobs; see GET /v1/admin/jobs?status=dead", metadata.TotalRecords)
+	}
+	return c
+}
+
+// checkAPI calls the readiness endpoint of the API at baseURL, which fails
+// while the API cannot reach its own dependencies.
+func checkAPI(baseURL string) check {
+	client := &http.Client{Timeout: healthTimeout}
+	url := strings.TrimSuffix(baseURL, "/") + "/v1/healthcheck/ready"
+	res, err := client.Get(url)
+	if err != nil {
+		return newCheck("api", err, "")
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return newCheck("api", fmt.Errorf("%s responded %s", url, res.Status), "")
+	}
+	return newCheck("api", nil, url+" responded "+res.Status)
+}
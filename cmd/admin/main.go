@@ -0,0 +1,238 @@
+// Command admin runs operational tasks against the DotaReplays database, so
+// that they do not have to be done with SQL by hand:
+//
+//	admin [flags] COMMAND [ARGS]
+//
+// The database is named by -db-dsn, or the DOTAREPLAYS_DB_DSN (or
+// DOTAREPLAYS_DB_DSN_FILE) environment variable the API reads. Run admin
+// without a command to list the commands. With -json, results and errors are
+// written to stdout as a single JSON object for scripts to read; the exit
+// status is 1 on failure and 2 on a malformed command either way.
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/i18n"
+	"DotaReplays/internal/validator"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	// Register the postgres driver with database/sql.
+	_ "github.com/lib/pq"
+)
+
+type admin struct {
+	db     *sql.DB
+	models data.Models
+	json   bool
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+type command struct {
+	name  string
+	args  string
+	about string
+	run   func(a *admin, args []string) error
+}
+
+var commands = []command{
+	{"users show", "EMAIL|ID", "Show a user and their permissions", (*admin).showUser},
+	{"users create", "-name NAME -email EMAIL -password PASSWORD|- [-locale LOCALE] [-activated] [-permissions CODES]", "Create a user", (*admin).createUser},
+	{"users activate", "EMAIL|ID", "Activate a user without the emailed token", (*admin).activateUser},
+	{"users delete", "EMAIL|ID", "Delete a user", (*admin).deleteUser},
+	{"permissions list", "[EMAIL|ID]", "List a user's permissions, or every permission", (*admin).listPermissions},
+	{"permissions grant", "EMAIL|ID CODE...", "Grant permissions to a user", (*admin).grantPermissions},
+	{"permissions revoke", "EMAIL|ID CODE...", "Revoke permissions from a user", (*admin).revokePermissions},
+	{"tokens list", "EMAIL|ID", "List a user's unexpired tokens", (*admin).listTokens},
+	{"tokens create", "[-ttl DURATION] EMAIL|ID", "Create an API key: a long-lived authentication token", (*admin).createToken},
+	{"tokens purge", "", "Delete expired tokens and sign-in requests", (*admin).purgeTokens},
+	{"replays export", "[-format csv|ndjson] [-o FILE] [-title TITLE] [-heroes HEROES]", "Export replays", (*admin).exportReplays},
+	{"replays import", "[-format csv|ndjson] [-dry-run] FILE|-", "Import replays", (*admin).importReplays},
+	{"health", "[-api URL]", "Check the database, migrations, job queue and API", (*admin).health},
+}
+
+// errUsage is returned for a malformed command, which is reported with the
+// command's usage line.
+var errUsage = errors.New("usage")
+
+// validationError reports invalid input with the same messages the API uses.
+type validationError map[string][]validator.Error
+
+func (e validationError) translate() map[string][]string {
+	translated := make(map[string][]string, len(e))
+	for field, fieldErrors := range e {
+		for _, fe := range fieldErrors {
+			translated[field] = append(translated[field], i18n.Translate(i18n.English, fe.Code, fe.Args...))
+		}
+	}
+	return translated
+}
+
+func (e validationError) Error() string {
+	translated := e.translate()
+	fields := make([]string, 0, len(translated))
+	for field := range translated {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var msgs []string
+	for _, field := range fields {
+		for _, msg := range translated[field] {
+			msgs = append(msgs, field+": "+msg)
+		}
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+func main() {
+	var dsn string
+	var asJSON bool
+	flag.StringVar(&dsn, "db-dsn", "", "PostgreSQL DSN (default $DOTAREPLAYS_DB_DSN)")
+	flag.BoolVar(&asJSON, "json", false, "Write results and errors as JSON")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, args, ok := findCommand(flag.Args())
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if dsn == "" {
+		var err error
+		dsn, err = dsnFromEnv()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "admin:", err)
+			os.Exit(2)
+		}
+	}
+	if dsn == "" {
+		fmt.Fprintln(os.Stderr, "admin: -db-dsn or DOTAREPLAYS_DB_DSN is required")
+		os.Exit(2)
+	}
+	// sql.Open does not connect, so health can report an unreachable
+	// database like any other failed check.
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	a := &admin{
+		db:     db,
+		models: data.NewModels(db),
+		json:   asJSON,
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+	}
+	err = cmd.run(a, args)
+	if err != nil {
+		db.Close()
+		os.Exit(a.fail(cmd, err))
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: admin [flags] COMMAND [ARGS]")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nCommands:")
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.about)
+	}
+	tw.Flush()
+}
+
+// findCommand matches the longest command name that args start with.
+func findCommand(args []string) (command, []string, bool) {
+	for n := 2; n >= 1; n-- {
+		if len(args) < n {
+			continue
+		}
+		name := strings.Join(args[:n], " ")
+		for _, cmd := range commands {
+			if cmd.name == name {
+				return cmd, args[n:], true
+			}
+		}
+	}
+	return command{}, nil, false
+}
+
+// dsnFromEnv reads the DSN the same way the API does.
+func dsnFromEnv() (string, error) {
+	dsn := os.Getenv("DOTAREPLAYS_DB_DSN")
+	file, ok := os.LookupEnv("DOTAREPLAYS_DB_DSN_FILE")
+	if !ok {
+		return dsn, nil
+	}
+	if dsn != "" {
+		return "", errors.New("only one of DOTAREPLAYS_DB_DSN and DOTAREPLAYS_DB_DSN_FILE may be set")
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("DOTAREPLAYS_DB_DSN_FILE: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// fail reports the error cmd returned and returns the exit status for it.
+func (a *admin) fail(cmd command, err error) int {
+	status := 1
+	if errors.Is(err, errUnhealthy) {
+		return status
+	}
+	if errors.Is(err, errUsage) {
+		status = 2
+		err = fmt.Errorf("usage: admin [flags] %s %s", cmd.name, cmd.args)
+	}
+	if !a.json {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		return status
+	}
+	body := map[string]any{"error": err.Error()}
+	var invalid validationError
+	if errors.As(err, &invalid) {
+		body["error"] = "invalid input"
+		body["errors"] = invalid.translate()
+	}
+	a.writeJSON(body)
+	return status
+}
+
+// print writes v as JSON with -json, and otherwise has text write it for
+// people to read, lined up in columns at tab stops.
+func (a *admin) print(v any, text func(w io.Writer)) error {
+	if a.json {
+		return a.writeJSON(v)
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	text(tw)
+	return tw.Flush()
+}
+
+func (a *admin) writeJSON(v any) error {
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// parseFlags parses a command's own flags, returning errUsage rather than
+// exiting if they are malformed.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+	if fs.Parse(args) != nil {
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// checkPermissions returns an error naming any of codes that is not a known
+// permission, which the model would otherwise skip without a word.
+func (a *admin) checkPermissions(codes []string) ([]string, error) {
+	known, err := a.models.Permissions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if !known.Include(code) {
+			return nil, fmt.Errorf("unknown permission %q; known permissions are %s", code, strings.Join(known, ", "))
+		}
+	}
+	return codes, nil
+}
+
+func (a *admin) listPermissions(args []string) error {
+	var permissions data.Permissions
+	var err error
+	switch len(args) {
+	case 0:
+		permissions, err = a.models.Permissions.GetAll()
+	case 1:
+		var user *data.User
+		user, err = a.findUser(args[0])
+		if err != nil {
+			return err
+		}
+		permissions, err = a.models.Permissions.GetAllForUser(user.ID)
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+	return a.print(map[string]data.Permissions{"permissions": permissions}, func(w io.Writer) {
+		for _, code := range permissions {
+			fmt.Fprintln(w, code)
+		}
+	})
+}
+
+func (a *admin) grantPermissions(args []string) error {
+	return a.changePermissions(args, data.PermissionModel.AddForUser)
+}
+
+func (a *admin) revokePermissions(args []string) error {
+	return a.changePermissions(args, data.PermissionModel.RemoveForUser)
+}
+
+func (a *admin) changePermissions(args []string, change func(m data.PermissionModel, userID int64, codes ...string) error) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	codes, err := a.checkPermissions(args[1:])
+	if err != nil {
+		return err
+	}
+	err = change(a.models.Permissions, user.ID, codes...)
+	if err != nil {
+		return err
+	}
+	return a.printUser(user)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/replayio"
+	"DotaReplays/internal/validator"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type importRow struct {
+	Line   int                 `json:"line"`
+	Status string              `json:"status"`
+	ID     int64               `json:"id,omitempty"`
+	Errors map[string][]string `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	DryRun   bool        `json:"dry_run"`
+	Total    int         `json:"total"`
+	Imported int         `json:"imported"`
+	Failed   int         `json:"failed"`
+	Rows     []importRow `json:"rows"`
+}
+
+// formatForPath picks the file format from the extension of path.
+func formatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	}
+	return ""
+}
+
+// exportReplays writes replays to stdout, or to the -o file with a summary
+// on stdout. Unlike the API it is not bound by a write timeout, so it suits
+// backups of the whole catalogue.
+func (a *admin) exportReplays(args []string) error {
+	fs := flag.NewFlagSet("replays export", flag.ContinueOnError)
+	format := fs.String("format", "", "")
+	out := fs.String("o", "", "")
+	title := fs.String("title", "", "")
+	heroes := fs.String("heroes", "", "")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	if *format == "" {
+		*format = formatForPath(*out)
+	}
+	if *format == "" {
+		*format = "ndjson"
+	}
+
+	var w io.Writer = a.stdout
+	var file *os.File
+	if *out != "" {
+		file, err = os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	var writer replayio.Writer
+	switch *format {
+	case "csv":
+		writer = replayio.NewCSVWriter(w)
+	case "ndjson":
+		writer = replayio.NewNDJSONWriter(w)
+	default:
+		return errUsage
+	}
+
+	filters := data.Filters{Sort: "id", SortSafelist: []string{"id"}}
+	exported := 0
+	err = a.models.Replays.Export(context.Background(), *title, splitList(*heroes), filters, func(replay *data.Replay) error {
+		exported++
+		return writer.Write(replay)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		return nil
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]any{"exported": exported, "file": *out}, func(w io.Writer) {
+		fmt.Fprintf(w, "exported %d replays to %s\n", exported, *out)
+	})
+}
+
+// importReplays imports replays in one transaction, as the API's import
+// endpoint does: invalid rows are reported and skipped, and the rest are
+// committed together.
+func (a *admin) importReplays(args []string) error {
+	fs := flag.NewFlagSet("replays import", flag.ContinueOnError)
+	format := fs.String("format", "", "")
+	dryRun := fs.Bool("dry-run", false, "")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = formatForPath(path)
+	}
+
+	var r io.Reader = a.stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	var reader replayio.Reader
+	switch *format {
+	case "csv":
+		reader = replayio.NewCSVReader(r)
+	case "ndjson":
+		reader = replayio.NewNDJSONReader(r)
+	default:
+		return errUsage
+	}
+
+	var importer *data.ReplayImporter
+	if !*dryRun {
+		importer, err = a.models.Replays.NewImporter()
+		if err != nil {
+			return err
+		}
+		defer importer.Rollback()
+	}
+
+	report := importReport{DryRun: *dryRun, Rows: []importRow{}}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		report.Total++
+		row := importRow{Line: record.Line}
+		if record.Err != nil {
+			row.Status = "invalid"
+			row.Errors = map[string][]string{"row": {record.Err.Error()}}
+			report.Failed++
+			report.Rows = append(report.Rows, row)
+			continue
+		}
+		v := validator.New()
+		if data.ValidateReplay(v, record.Replay); !v.Valid() {
+			row.Status = "invalid"
+			row.Errors = validationError(v.Errors).translate()
+			report.Failed++
+			report.Rows = append(report.Rows, row)
+			continue
+		}
+		if *dryRun {
+			row.Status = "valid"
+		} else {
+			err = importer.Insert(record.Replay)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", record.Line, err)
+			}
+			row.Status = "created"
+			row.ID = record.Replay.ID
+			report.Imported++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	if !*dryRun {
+		err = importer.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return a.print(map[string]importReport{"report": report}, func(w io.Writer) {
+		for _, row := range report.Rows {
+			for field, msgs := range row.Errors {
+				fmt.Fprintf(w, "line %d\t%s\t%s\n", row.Line, field, strings.Join(msgs, "; "))
+			}
+		}
+		verb := "imported"
+		if report.DryRun {
+			verb = "would import"
+		}
+		fmt.Fprintf(w, "%s %d of %d replays, %d invalid\n", verb, report.Total-report.Failed, report.Total, report.Failed)
+	})
+}
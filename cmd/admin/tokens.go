@@ -0,0 +1,83 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+type tokenView struct {
+	Scope  string    `json:"scope"`
+	Expiry time.Time `json:"expiry"`
+}
+
+func (a *admin) listTokens(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	tokens, err := a.models.Tokens.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	views := make([]tokenView, len(tokens))
+	for i, token := range tokens {
+		views[i] = tokenView{Scope: token.Scope, Expiry: token.Expiry}
+	}
+	return a.print(map[string][]tokenView{"tokens": views}, func(w io.Writer) {
+		fmt.Fprintln(w, "SCOPE\tEXPIRY")
+		for _, token := range views {
+			fmt.Fprintf(w, "%s\t%s\n", token.Scope, token.Expiry.Local().Format(time.RFC3339))
+		}
+	})
+}
+
+// createToken issues an authentication token for scripts and other services
+// to use as an API key. The plaintext is shown once and cannot be recovered;
+// deleting the user's authentication tokens revokes it.
+func (a *admin) createToken(args []string) error {
+	fs := flag.NewFlagSet("tokens create", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 90*24*time.Hour, "")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 1 || *ttl <= 0 {
+		return errUsage
+	}
+	user, err := a.findUser(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !user.Activated {
+		return fmt.Errorf("user %d is not activated, and could not use the token", user.ID)
+	}
+	token, err := a.models.Tokens.New(user.ID, *ttl, data.ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]*data.Token{"authentication_token": token}, func(w io.Writer) {
+		fmt.Fprintf(w, "Token\t%s\n", token.Plaintext)
+		fmt.Fprintf(w, "Expiry\t%s\n", token.Expiry.Local().Format(time.RFC3339))
+	})
+}
+
+func (a *admin) purgeTokens(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	n, err := a.models.Tokens.DeleteExpired()
+	if err != nil {
+		return err
+	}
+	// Sign-ins that were abandoned half way leave their requests behind.
+	requests, err := a.models.AuthRequests.DeleteExpired()
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]int64{"deleted": n, "deleted_auth_requests": requests}, func(w io.Writer) {
+		fmt.Fprintf(w, "deleted %d expired tokens and %d expired sign-in requests\n", n, requests)
+	})
+}
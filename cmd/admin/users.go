@@ -0,0 +1,179 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/validator"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type userView struct {
+	*data.User
+	Permissions data.Permissions `json:"permissions"`
+}
+
+// findUser looks up a user by ID if ref is a number and by email otherwise.
+func (a *admin) findUser(ref string) (*data.User, error) {
+	var user *data.User
+	var err error
+	if id, parseErr := strconv.ParseInt(ref, 10, 64); parseErr == nil {
+		user, err = a.models.Users.Get(id)
+	} else {
+		user, err = a.models.Users.GetByEmail(ref)
+	}
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no user %q", ref)
+	}
+	return user, err
+}
+
+func (a *admin) printUser(user *data.User) error {
+	permissions, err := a.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+	return a.print(userView{user, permissions}, func(w io.Writer) {
+		fmt.Fprintf(w, "ID\t%d\n", user.ID)
+		fmt.Fprintf(w, "Name\t%s\n", user.Name)
+		fmt.Fprintf(w, "Email\t%s\n", user.Email)
+		fmt.Fprintf(w, "Activated\t%t\n", user.Activated)
+		fmt.Fprintf(w, "Locale\t%s\n", user.Locale)
+		if user.SteamID != "" {
+			fmt.Fprintf(w, "Steam ID\t%s\n", user.SteamID)
+		}
+		fmt.Fprintf(w, "Created\t%s\n", user.CreatedAt.Local().Format(time.RFC3339))
+		fmt.Fprintf(w, "Permissions\t%s\n", strings.Join(permissions, ", "))
+	})
+}
+
+func (a *admin) showUser(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	return a.printUser(user)
+}
+
+// createUser creates a user directly, skipping the welcome email. It is meant
+// for the first administrator and for service accounts, so the user can be
+// activated and given permissions in the same step.
+func (a *admin) createUser(args []string) error {
+	fs := flag.NewFlagSet("users create", flag.ContinueOnError)
+	name := fs.String("name", "", "")
+	email := fs.String("email", "", "")
+	password := fs.String("password", "", "")
+	locale := fs.String("locale", "en", "")
+	activated := fs.Bool("activated", false, "")
+	permissions := fs.String("permissions", "replays:read", "")
+	err := parseFlags(fs, args)
+	if err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	// A password on the command line is visible to other users of the
+	// machine, so "-" reads it from the first line of stdin instead.
+	if *password == "-" {
+		line, err := bufio.NewReader(a.stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	user := &data.User{
+		Name:      *name,
+		Email:     *email,
+		Activated: *activated,
+		Locale:    *locale,
+	}
+	err = user.Password.Set(*password)
+	if err != nil {
+		return err
+	}
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return validationError(v.Errors)
+	}
+	codes, err := a.checkPermissions(splitList(*permissions))
+	if err != nil {
+		return err
+	}
+	err = a.models.WithTx(func(tx data.Models) error {
+		err := tx.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+		return tx.Permissions.AddForUser(user.ID, codes...)
+	})
+	if errors.Is(err, data.ErrDuplicateEmail) {
+		v.AddError("email", "duplicate_email")
+		return validationError(v.Errors)
+	}
+	if err != nil {
+		return err
+	}
+	return a.printUser(user)
+}
+
+// activateUser activates a user whose activation email went astray.
+func (a *admin) activateUser(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	if !user.Activated {
+		user.Activated = true
+		err = a.models.WithTx(func(tx data.Models) error {
+			err := tx.Users.Update(user)
+			if err != nil {
+				return err
+			}
+			return tx.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return a.printUser(user)
+}
+
+func (a *admin) deleteUser(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	err = a.models.Users.Delete(user.ID)
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]int64{"deleted": user.ID}, func(w io.Writer) {
+		fmt.Fprintf(w, "deleted user %d (%s)\n", user.ID, user.Email)
+	})
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
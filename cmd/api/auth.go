@@ -0,0 +1,213 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/validator"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const authRequestTTL = 10 * time.Minute
+
+// reauthenticationTTL is how long a fresh sign-in through a linked provider
+// stands in for the password.
+const reauthenticationTTL = 5 * time.Minute
+
+// externalAccount is what an external provider told us about the person who
+// signed in. LinkByEmail lets a login claim an existing account with the same
+// address. When ManagePermissions is set the provider is the source of truth
+// for permissions, and the user's are replaced with Permissions on each login.
+type externalAccount struct {
+	Provider          string
+	Subject           string
+	Name              string
+	Email             string
+	SteamID           string
+	LinkByEmail       bool
+	ManagePermissions bool
+	Permissions       []string
+}
+
+// completeExternalLogin finishes a login or link once the provider's response
+// has been verified. For a link the identity is attached to the user who
+// started the flow. For a login the linked user is signed in, and a new
+// activated account is created if there is none yet.
+func (app *application) completeExternalLogin(w http.ResponseWriter, r *http.Request, req *data.AuthRequest, account externalAccount) {
+	identity, err := app.modelsFor(r).Identities.Get(account.Provider, account.Subject)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if req.UserID != nil {
+		if identity != nil && identity.UserID != *req.UserID {
+			app.identityConflictResponse(w, r)
+			return
+		}
+		user, err := app.modelsFor(r).Users.Get(*req.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env := envelope{"user": user}
+		if identity == nil {
+			identity, err = app.linkIdentity(r, user, account)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrDuplicateIdentity):
+					app.identityConflictResponse(w, r)
+				case errors.Is(err, data.ErrEditConflict):
+					app.editConflictResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		} else {
+			// Signing in again with an identity that was already linked
+			// proves control of the account as well as a password does, so
+			// it earns a token that can be used in place of one. A newly
+			// linked identity does not, or a stolen session could link one.
+			token, err := app.modelsFor(r).Tokens.New(user.ID, reauthenticationTTL, data.ScopeReauthentication)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			env["reauthentication_token"] = token
+		}
+		env["identity"] = identity
+		err = app.writeResponse(w, r, http.StatusOK, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var user *data.User
+	status := http.StatusOK
+	switch {
+	case identity != nil:
+		user, err = app.modelsFor(r).Users.Get(identity.UserID)
+	case account.LinkByEmail && account.Email != "":
+		user, err = app.modelsFor(r).Users.GetByEmail(account.Email)
+		if err == nil {
+			_, err = app.linkIdentity(r, user, account)
+			break
+		}
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			break
+		}
+		fallthrough
+	default:
+		user, err = app.createExternalUser(r, account)
+		status = http.StatusCreated
+	}
+	if err == nil && account.ManagePermissions && status == http.StatusOK {
+		err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+			return tx.Permissions.SetForUser(user.ID, account.Permissions...)
+		})
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateIdentity):
+			// A concurrent callback for the same account won the race.
+			app.identityConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v := validator.New()
+			v.AddError("email", "duplicate_email")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	token, err := app.modelsFor(r).Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, status, envelope{"authentication_token": token, "user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) linkIdentity(r *http.Request, user *data.User, account externalAccount) (*data.Identity, error) {
+	identity := &data.Identity{
+		UserID:   user.ID,
+		Provider: account.Provider,
+		Subject:  account.Subject,
+	}
+	err := app.modelsFor(r).WithTx(func(tx data.Models) error {
+		err := tx.Identities.Insert(identity)
+		if err != nil {
+			return err
+		}
+		// A verified Steam ID replaces whatever the account had before.
+		if account.SteamID != "" && user.SteamID != account.SteamID {
+			user.SteamID = account.SteamID
+			return tx.Users.Update(user)
+		}
+		return nil
+	})
+	return identity, err
+}
+
+// createExternalUser creates an activated account for someone who signed in
+// with a provider for the first time. Such accounts have a random password
+// and, if the provider gave no email address, a placeholder one in the
+// reserved .invalid domain, both of which the user can change later. Where a
+// password is asked for, a reauthentication token from signing in again
+// with the provider is accepted instead.
+func (app *application) createExternalUser(r *http.Request, account externalAccount) (*data.User, error) {
+	user := &data.User{
+		Name:      account.Name,
+		Email:     account.Email,
+		Activated: true,
+		Locale:    app.locale(r),
+		SteamID:   account.SteamID,
+	}
+	if user.Name == "" {
+		user.Name = fmt.Sprintf("%s user %s", account.Provider, account.Subject)
+	}
+	if user.Email == "" {
+		user.Email = fmt.Sprintf("%s-%s@users.invalid", account.Provider, account.Subject)
+	}
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	// bcrypt only looks at the first 72 bytes, and base64 of 32 bytes is 43.
+	err = user.Password.Set(base64.RawURLEncoding.EncodeToString(randomBytes))
+	if err != nil {
+		return nil, err
+	}
+	err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+		err := tx.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+		permissions := []string{"replays:read"}
+		if account.ManagePermissions {
+			permissions = account.Permissions
+		}
+		err = tx.Permissions.AddForUser(user.ID, permissions...)
+		if err != nil {
+			return err
+		}
+		return tx.Identities.Insert(&data.Identity{
+			UserID:   user.ID,
+			Provider: account.Provider,
+			Subject:  account.Subject,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
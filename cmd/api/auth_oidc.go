@@ -0,0 +1,227 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/oidc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var providerNameRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// oidcProvider is an OpenID Connect provider from the -oidc-config file,
+// together with the rules that turn its claims into a user.
+type oidcProvider struct {
+	*oidc.Provider
+	name               string
+	emailClaim         string
+	nameClaim          string
+	rolesClaim         string
+	roles              map[string][]string
+	defaultPermissions []string
+	trustEmail         bool
+	linkByEmail        bool
+}
+
+// oidcConfig is the format of the -oidc-config file, for example:
+//
+//	{"providers": [{
+//	    "name": "corp",
+//	    "issuer": "https://sso.example.com",
+//	    "client_id": "dotareplays",
+//	    "client_secret": "...",
+//	    "scopes": ["openid", "email", "profile", "groups"],
+//	    "roles_claim": "groups",
+//	    "roles": {"replay-editors": ["replays:read", "replays:write"]},
+//	    "default_permissions": ["replays:read"]
+//	}]}
+//
+// When roles_claim is set, the user's permissions are replaced on every login
+// with default_permissions plus those of each role listed in that claim.
+type oidcConfig struct {
+	Providers []struct {
+		Name               string              `json:"name"`
+		Issuer             string              `json:"issuer"`
+		ClientID           string              `json:"client_id"`
+		ClientSecret       string              `json:"client_secret"`
+		Scopes             []string            `json:"scopes"`
+		EmailClaim         string              `json:"email_claim"`
+		NameClaim          string              `json:"name_claim"`
+		RolesClaim         string              `json:"roles_claim"`
+		Roles              map[string][]string `json:"roles"`
+		DefaultPermissions []string            `json:"default_permissions"`
+		TrustEmail         bool                `json:"trust_email"`
+		LinkByEmail        bool                `json:"link_by_email"`
+	} `json:"providers"`
+}
+
+// loadOIDCProviders reads the providers in the file at path. An empty path
+// means no providers are configured.
+func loadOIDCProviders(path, baseURL string) (map[string]*oidcProvider, error) {
+	providers := make(map[string]*oidcProvider)
+	if path == "" {
+		return providers, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg oidcConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, c := range cfg.Providers {
+		switch {
+		case !providerNameRX.MatchString(c.Name) || c.Name == data.ProviderSteam:
+			return nil, fmt.Errorf("%s: invalid provider name %q", path, c.Name)
+		case providers[c.Name] != nil:
+			return nil, fmt.Errorf("%s: duplicate provider %q", path, c.Name)
+		case c.Issuer == "" || c.ClientID == "":
+			return nil, fmt.Errorf("%s: provider %q needs an issuer and a client_id", path, c.Name)
+		}
+		p := &oidcProvider{
+			Provider: oidc.New(oidc.Config{
+				Issuer:       c.Issuer,
+				ClientID:     c.ClientID,
+				ClientSecret: c.ClientSecret,
+				RedirectURL:  strings.TrimRight(baseURL, "/") + "/v1/auth/oidc/" + c.Name + "/callback",
+				Scopes:       c.Scopes,
+			}),
+			name:               c.Name,
+			emailClaim:         c.EmailClaim,
+			nameClaim:          c.NameClaim,
+			rolesClaim:         c.RolesClaim,
+			roles:              c.Roles,
+			defaultPermissions: c.DefaultPermissions,
+			trustEmail:         c.TrustEmail,
+			linkByEmail:        c.LinkByEmail,
+		}
+		if p.Scopes == nil {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+		if p.emailClaim == "" {
+			p.emailClaim = "email"
+		}
+		if p.nameClaim == "" {
+			p.nameClaim = "name"
+		}
+		providers[c.Name] = p
+	}
+	return providers, nil
+}
+
+// account maps verified claims to an externalAccount. The email address is
+// only used when the provider says it is verified, or is trusted to.
+func (p *oidcProvider) account(claims oidc.Claims) externalAccount {
+	account := externalAccount{
+		Provider: p.name,
+		Subject:  claims.Subject(),
+		Name:     claims.String(p.nameClaim),
+	}
+	if account.Name == "" {
+		account.Name = claims.String("preferred_username")
+	}
+	if p.trustEmail || claims.Bool("email_verified") {
+		account.Email = claims.String(p.emailClaim)
+		account.LinkByEmail = p.linkByEmail
+	}
+	if p.rolesClaim != "" {
+		account.ManagePermissions = true
+		set := make(map[string]bool)
+		for _, code := range p.defaultPermissions {
+			set[code] = true
+		}
+		for _, role := range claims.Strings(p.rolesClaim) {
+			for _, code := range p.roles[role] {
+				set[code] = true
+			}
+		}
+		for code := range set {
+			account.Permissions = append(account.Permissions, code)
+		}
+		sort.Strings(account.Permissions)
+	}
+	return account
+}
+
+func (app *application) oidcProviderFromRequest(r *http.Request) *oidcProvider {
+	return app.oidc[httprouter.ParamsFromContext(r.Context()).ByName("provider")]
+}
+
+// startOIDCLoginHandler returns the provider URL to send the user to. As with
+// Steam, an authenticated request links the account to the current user.
+func (app *application) startOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider := app.oidcProviderFromRequest(r)
+	if provider == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var userID *int64
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		userID = &user.ID
+	}
+	req, err := app.modelsFor(r).AuthRequests.New(provider.name, userID, func(string) string {
+		return provider.RedirectURL
+	}, authRequestTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	redirectURL, err := provider.AuthURL(r.Context(), req.State, req.Nonce, req.CodeVerifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"redirect_url": redirectURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider := app.oidcProviderFromRequest(r)
+	if provider == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	qs := r.URL.Query()
+	req, err := app.modelsFor(r).AuthRequests.Consume(provider.name, qs.Get("state"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.externalAuthFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The provider reports refusals, such as the user cancelling, as an error
+	// parameter instead of a code.
+	if qs.Get("error") != "" || qs.Get("code") == "" {
+		app.externalAuthFailedResponse(w, r)
+		return
+	}
+	claims, err := provider.Exchange(r.Context(), qs.Get("code"), req.CodeVerifier, req.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidResponse), errors.Is(err, oidc.ErrInvalidToken):
+			app.logError(r, err)
+			app.externalAuthFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.completeExternalLogin(w, r, req, provider.account(claims))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/openid"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// startSteamLoginHandler returns the Steam URL to send the user to. When the
+// request is authenticated the Steam account is linked to the current user,
+// otherwise the callback signs in, creating an account if needed.
+func (app *application) startSteamLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var userID *int64
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		userID = &user.ID
+	}
+	realm := strings.TrimRight(app.config.baseURL, "/")
+	req, err := app.modelsFor(r).AuthRequests.New(data.ProviderSteam, userID, func(state string) string {
+		return realm + "/v1/auth/steam/callback?state=" + url.QueryEscape(state)
+	}, authRequestTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{"redirect_url": app.steam.AuthURL(req.RedirectURI, realm)}
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) steamCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	req, err := app.modelsFor(r).AuthRequests.Consume(data.ProviderSteam, qs.Get("state"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.externalAuthFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	claimedID, err := app.steam.Verify(r.Context(), qs, req.RedirectURI)
+	if err != nil {
+		switch {
+		case errors.Is(err, openid.ErrCancelled),
+			errors.Is(err, openid.ErrInvalidResponse),
+			errors.Is(err, openid.ErrNotVerified):
+			app.externalAuthFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	steamID, err := app.steam.SteamID(claimedID)
+	if err != nil {
+		app.externalAuthFailedResponse(w, r)
+		return
+	}
+	app.completeExternalLogin(w, r, req, externalAccount{
+		Provider: data.ProviderSteam,
+		Subject:  steamID,
+		SteamID:  steamID,
+	})
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"DotaReplays/internal/i18n"
+	"DotaReplays/internal/validator"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// envPrefix starts the environment variable of every flag: -db-dsn is read
+// from DOTAREPLAYS_DB_DSN, or from the file named by DOTAREPLAYS_DB_DSN_FILE.
+const envPrefix = "DOTAREPLAYS_"
+
+// layerFlags are the flags that pick the configuration, which cannot
+// themselves come from it.
+var layerFlags = map[string]bool{"config": true, "print-config": true}
+
+// secretFlags are redacted by -print-config.
+var secretFlags = map[string]bool{"db-dsn": true, "smtp-password": true}
+
+// loadConfig layers the configuration: flag defaults, then the file at path,
+// then DOTAREPLAYS_* environment variables, then the command line. fs must
+// already be parsed; only flags not given on the command line are changed.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	set := func(name, value, source string) error {
+		if explicit[name] {
+			return nil
+		}
+		err := fs.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", source, name, err)
+		}
+		return nil
+	}
+
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if fs.Lookup(name) == nil || layerFlags[name] {
+				return fmt.Errorf("%s: unknown setting %q", path, name)
+			}
+			err := set(name, values[name], path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || layerFlags[f.Name] {
+			return
+		}
+		env := envName(f.Name)
+		value, ok := os.LookupEnv(env)
+		if file, fileOK := os.LookupEnv(env + "_FILE"); fileOK {
+			if ok {
+				err = fmt.Errorf("only one of %s and %s_FILE may be set", env, env)
+				return
+			}
+			var b []byte
+			b, err = os.ReadFile(file)
+			if err != nil {
+				err = fmt.Errorf("%s_FILE: %w", env, err)
+				return
+			}
+			value, ok = strings.TrimRight(string(b), "\r\n"), true
+		}
+		if ok {
+			err = set(f.Name, value, env)
+		}
+	})
+	return err
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readConfigFile reads a YAML or TOML file, chosen by extension, into flag
+// values. Keys are flag names; nested tables are joined with dashes, so
+//
+//	db:
+//	  dsn: postgres://...
+//
+// sets -db-dsn. Underscores in keys are read as dashes.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &doc)
+	case ".toml":
+		err = toml.Unmarshal(b, &doc)
+	default:
+		return nil, fmt.Errorf("%s: config file must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]string)
+	err = flattenConfig(values, "", doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flattenConfig(values map[string]string, prefix string, doc map[string]any) error {
+	for key, value := range doc {
+		name := strings.ReplaceAll(key, "_", "-")
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		switch value := value.(type) {
+		case map[string]any:
+			err := flattenConfig(values, name, value)
+			if err != nil {
+				return err
+			}
+		case []any:
+			return fmt.Errorf("%s: must be a single value, not a list", name)
+		case nil:
+			// An empty key such as "smtp-password:" leaves the default.
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// validate checks the settings that flag parsing cannot, reporting every
+// problem at once.
+func (cfg config) validate() error {
+	v := validator.New()
+	cfg.checkDB(v)
+	cfg.checkLog(v)
+	checkPort(v, "port", cfg.port, 1)
+	v.Check(isHost(cfg.admin.addr), "admin-addr", "host")
+	checkPort(v, "admin-port", cfg.admin.port, 0)
+	v.Check(cfg.admin.port != cfg.port, "admin-port", "not_equal", "-port")
+	v.Check(validator.PermittedValue(cfg.env, "development", "staging", "production"), "env", "oneof", "development, staging, production")
+	v.Check(isHTTPURL(cfg.baseURL), "base-url", "url")
+	v.Check(cfg.shutdownDelay >= 0, "shutdown-delay", "non_negative")
+
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.rps > 0, "limiter-rps", "positive")
+		v.Check(cfg.limiter.burst > 0, "limiter-burst", "positive")
+	}
+	v.Check(cfg.export.writeTimeout > 0, "export-write-timeout", "positive")
+
+	v.Check(cfg.jobs.workers > 0, "jobs-workers", "positive")
+	v.Check(cfg.jobs.pollInterval > 0, "jobs-poll-interval", "positive")
+	v.Check(cfg.jobs.timeout > 0, "jobs-timeout", "positive")
+	v.Check(cfg.jobs.maxAttempts > 0, "jobs-max-attempts", "positive")
+
+	v.Check(validator.PermittedValue(cfg.mailer.backend, "smtp", "file", "log"), "mailer", "oneof", "smtp, file, log")
+	v.Check(cfg.smtp.sender != "", "smtp-sender", "required")
+	// The log backend writes activation and email-change tokens to the log
+	// instead of sending them, which is only acceptable on a developer's
+	// machine.
+	if cfg.env != "development" {
+		v.Check(cfg.mailer.backend != "log", "mailer", "not_allowed_in_env", "log")
+	}
+	switch cfg.mailer.backend {
+	case "smtp":
+		v.Check(cfg.smtp.host != "", "smtp-host", "required")
+		checkPort(v, "smtp-port", cfg.smtp.port, 1)
+		// Relays that accept mail without authentication need neither, but
+		// production is expected to authenticate.
+		if cfg.env == "production" {
+			v.Check(cfg.smtp.username != "", "smtp-username", "required")
+			v.Check(cfg.smtp.password != "", "smtp-password", "required")
+		} else {
+			v.Check(cfg.smtp.password == "" || cfg.smtp.username != "", "smtp-username", "required")
+			v.Check(cfg.smtp.username == "" || cfg.smtp.password != "", "smtp-password", "required")
+		}
+	case "file":
+		v.Check(cfg.mailer.dir != "", "mailer-dir", "required")
+	}
+
+	v.Check(isHTTPURL(cfg.steam.endpoint), "steam-openid-endpoint", "url")
+	v.Check(validator.PermittedValue(cfg.trace.exporter, "none", "stdout", "file"), "trace-exporter", "oneof", "none, stdout, file")
+	if cfg.trace.exporter == "file" {
+		v.Check(cfg.trace.file != "", "trace-file", "required")
+	}
+	if cfg.accessTokens.keysDir != "" {
+		v.Check(cfg.accessTokens.ttl > 0, "access-token-ttl", "positive")
+		v.Check(cfg.accessTokens.refreshTTL > 0, "refresh-token-ttl", "positive")
+	}
+	return configError(v)
+}
+
+// validateMigrate checks only the settings the migrate subcommand uses, so
+// that migrations can run from an environment that lacks, say, the SMTP
+// credentials the server itself needs.
+func (cfg config) validateMigrate() error {
+	v := validator.New()
+	cfg.checkDB(v)
+	cfg.checkLog(v)
+	return configError(v)
+}
+
+func (cfg config) checkDB(v *validator.Validator) {
+	v.Check(cfg.db.dsn != "", "db-dsn", "required")
+	v.Check(cfg.db.maxOpenConns > 0, "db-max-open-conns", "positive")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "non_negative")
+	v.Check(cfg.db.maxIdleTime > 0, "db-max-idle-time", "positive")
+}
+
+func (cfg config) checkLog(v *validator.Validator) {
+	if cfg.log.file != "" {
+		v.Check(cfg.log.fileMaxSize > 0, "log-file-max-size", "positive")
+		v.Check(cfg.log.fileMaxBackups >= 0, "log-file-max-backups", "non_negative")
+	}
+	v.Check(cfg.log.sampleFirst >= 0, "log-sample-first", "non_negative")
+	v.Check(cfg.log.sampleThereafter >= 0, "log-sample-thereafter", "non_negative")
+}
+
+// configError returns the errors in v as one, or nil if there are none.
+func configError(v *validator.Validator) error {
+	if v.Valid() {
+		return nil
+	}
+	keys := make([]string, 0, len(v.Errors))
+	for key := range v.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var msgs []string
+	for _, key := range keys {
+		for _, e := range v.Errors[key] {
+			msgs = append(msgs, fmt.Sprintf("  -%s: %s", key, i18n.Translate(i18n.English, e.Code, e.Args...)))
+		}
+	}
+	return errors.New("invalid configuration:\n" + strings.Join(msgs, "\n"))
+}
+
+func checkPort(v *validator.Validator, key string, port, min int) {
+	v.Check(port >= min, key, "min_value", min)
+	v.Check(port <= 65535, key, "max_value", 65535)
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isHost reports whether s is a host name or IP address, with no port, that
+// net.JoinHostPort can join one to.
+func isHost(s string) bool {
+	return s != "" && (net.ParseIP(s) != nil || !strings.ContainsAny(s, ":/[] "))
+}
+
+// printConfig writes the effective configuration as YAML that loadConfig can
+// read back, with secrets redacted.
+func printConfig(w io.Writer, fs *flag.FlagSet) error {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if layerFlags[f.Name] {
+			return
+		}
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = redactSecret(value)
+		}
+		values[f.Name] = value
+	})
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// redactSecret hides a secret, keeping the rest of a URL such as a DSN so
+// that the host and database can still be checked.
+func redactSecret(value string) string {
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+		return u.String()
+	}
+	return "[REDACTED]"
+}
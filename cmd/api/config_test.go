@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidateMigrate checks that a production configuration with only the
+// database set is enough to run migrations, but not to serve.
+func TestValidateMigrate(t *testing.T) {
+	var cfg config
+	cfg.port = 4000
+	cfg.admin.addr = "127.0.0.1"
+	cfg.admin.port = 4001
+	cfg.env = "production"
+	cfg.baseURL = "https://api.example.com"
+	cfg.db.dsn = "postgres://dotareplays@localhost/dotareplays"
+	cfg.db.maxOpenConns = 25
+	cfg.db.maxIdleConns = 25
+	cfg.db.maxIdleTime = 15 * time.Minute
+	cfg.mailer.backend = "smtp"
+
+	err := cfg.validateMigrate()
+	if err != nil {
+		t.Fatalf("validateMigrate: %v", err)
+	}
+	err = cfg.validate()
+	if err == nil || !strings.Contains(err.Error(), "-smtp-password") {
+		t.Errorf("validate: got %v, want an error about -smtp-password", err)
+	}
+
+	cfg.db.dsn = ""
+	err = cfg.validateMigrate()
+	if err == nil || !strings.Contains(err.Error(), "-db-dsn") {
+		t.Errorf("validateMigrate without a DSN: got %v, want an error about -db-dsn", err)
+	}
+}
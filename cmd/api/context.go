@@ -8,9 +8,19 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	permissionsContextKey = contextKey("permissions")
+	mediaTypeContextKey   = contextKey("mediaType")
+	requestIDContextKey   = contextKey("requestID")
+	requestInfoContextKey = contextKey("requestInfo")
+)
 
+// contextSetUser also notes the user's ID for the access log.
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+		info.userID = user.ID
+	}
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -22,3 +32,43 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// contextSetPermissions records the permissions carried by a signed access
+// token. Requests authenticated any other way have none in their context.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+func (app *application) contextSetMediaType(r *http.Request, mediaType string) *http.Request {
+	ctx := context.WithValue(r.Context(), mediaTypeContextKey, mediaType)
+	return r.WithContext(ctx)
+}
+
+// contextGetMediaType falls back to JSON so that responses written before
+// content negotiation has run, such as recovered panics, are still encoded.
+func (app *application) contextGetMediaType(r *http.Request) string {
+	mediaType, ok := r.Context().Value(mediaTypeContextKey).(string)
+	if !ok {
+		return mediaTypeJSON
+	}
+	return mediaType
+}
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"DotaReplays/internal/mailer"
+	"DotaReplays/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// previewEmailHandler renders an email template with sample data so that it
+// can be checked in a browser. It is only routed in development.
+func (app *application) previewEmailHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("template")
+	if !strings.HasSuffix(name, ".tmpl") {
+		name += ".tmpl"
+	}
+	if !validator.PermittedValue(name, mailer.Templates()...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	locale := app.readString(qs, "locale", app.locale(r))
+	format := app.readString(qs, "format", "html")
+	v.Check(validator.PermittedValue(format, "html", "text"), "format", "oneof", "html, text")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	msg, err := app.emails.Render("preview@example.com", locale, name, mailer.SampleData(name))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("X-Email-Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	if format == "text" {
+		app.write(w, http.StatusOK, "text/plain; charset=utf-8", []byte(msg.PlainBody), headers)
+		return
+	}
+	app.write(w, http.StatusOK, "text/html; charset=utf-8", []byte(msg.HTMLBody), headers)
+}
@@ -1,83 +1,189 @@
 package main
 
 import (
-	"fmt"
+	"DotaReplays/internal/i18n"
+	"DotaReplays/internal/jsonlog"
+	"DotaReplays/internal/trace"
+	"DotaReplays/internal/validator"
 	"net/http"
+	"sort"
 )
 
-func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
-		"request_method": r.Method,
-		"request_url":    r.URL.String(),
-	})
+const problemTypePrefix = "urn:dotareplays:problem:"
+
+// Stable, machine-readable error codes. Clients should match on these rather
+// than on the human-readable title or detail.
+const (
+	codeServerError                = "server_error"
+	codeNotFound                   = "not_found"
+	codeMethodNotAllowed           = "method_not_allowed"
+	codeBadRequest                 = "bad_request"
+	codeNotAcceptable              = "not_acceptable"
+	codeUnsupportedMediaType       = "unsupported_media_type"
+	codeValidationFailed           = "validation_failed"
+	codeEditConflict               = "edit_conflict"
+	codeRateLimitExceeded          = "rate_limit_exceeded"
+	codeInvalidCredentials         = "invalid_credentials"
+	codeInvalidAuthenticationToken = "invalid_authentication_token"
+	codeAuthenticationRequired     = "authentication_required"
+	codeInactiveAccount            = "inactive_account"
+	codeNotPermitted               = "not_permitted"
+	codeExternalAuthFailed         = "external_auth_failed"
+	codeIdentityConflict           = "identity_conflict"
+)
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+type fieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// logError logs err with the details of the request that caused it and any
+// extra fields, such as the stack of a recovered panic. Only the path of the
+// request is logged, as the query of a sign-in callback carries the codes and
+// assertions that complete it.
+func (app *application) logError(r *http.Request, err error, extra ...jsonlog.Field) {
+	fields := []jsonlog.Field{
+		jsonlog.String("request_id", app.contextGetRequestID(r)),
+		jsonlog.String("request_method", r.Method),
+		jsonlog.String("request_path", r.URL.Path),
+	}
+	if span := trace.SpanFromContext(r.Context()); span != nil {
+		span.RecordError(err)
+		fields = append(fields, jsonlog.String("trace_id", span.TraceID()), jsonlog.String("span_id", span.SpanID()))
+	}
+	app.logger.Error(err, append(fields, extra...)...)
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	env := envelope{"error": message}
+// errorResponse sends a problem whose detail is the catalogue message for code,
+// rendered in the client's locale with args.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, args ...any) {
+	locale := app.locale(r)
+	detail := i18n.Translate(locale, "problem."+code+".detail", args...)
+	app.problemResponse(w, r, problem{Status: status, Code: code, Detail: detail})
+}
 
-	err := app.writeJSON(w, status, env, nil)
+func (app *application) problemResponse(w http.ResponseWriter, r *http.Request, p problem) {
+	locale := app.locale(r)
+	p.Type = problemTypePrefix + p.Code
+	p.Title = i18n.Translate(locale, "problem."+p.Code+".title")
+	p.Instance = app.contextGetRequestID(r)
+	p.RequestID = p.Instance
+	w.Header().Set("Content-Language", locale)
+
+	// Errors are never lists, so anything other than MessagePack falls back
+	// to JSON rather than failing negotiation a second time.
+	mediaType := app.contextGetMediaType(r)
+	if mediaType != mediaTypeMsgpack {
+		mediaType = mediaTypeJSON
+	}
+	body, err := app.encode(r, mediaType, p)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
+		return
+	}
+	if mediaType == mediaTypeJSON {
+		mediaType = "application/problem+json"
 	}
+	app.write(w, p.Status, mediaType, body, nil)
 }
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
-	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, codeServerError)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
-	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, codeNotFound)
 }
 
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
-	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.problemResponse(w, r, problem{
+		Status: http.StatusBadRequest,
+		Code:   codeBadRequest,
+		Detail: app.translateError(r, err),
+	})
+}
+
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusNotAcceptable, codeNotAcceptable)
 }
 
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, r.Header.Get("Content-Type"))
+}
+
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string][]validator.Error) {
+	locale := app.locale(r)
+	p := problem{
+		Status: http.StatusUnprocessableEntity,
+		Code:   codeValidationFailed,
+		Detail: i18n.Translate(locale, "problem.validation_failed.detail"),
+		Errors: make([]fieldError, 0, len(errors)),
+	}
+	for field, fieldErrors := range errors {
+		for _, e := range fieldErrors {
+			p.Errors = append(p.Errors, fieldError{
+				Field:  field,
+				Code:   e.Code,
+				Detail: i18n.Translate(locale, e.Code, e.Args...),
+			})
+		}
+	}
+	sort.SliceStable(p.Errors, func(i, j int) bool { return p.Errors[i].Field < p.Errors[j].Field })
+	app.problemResponse(w, r, p)
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
-	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, http.StatusConflict, codeEditConflict)
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
-	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorResponse(w, r, http.StatusTooManyRequests, codeRateLimitExceeded)
 }
 
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
-	message := "invalid authentication credentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, codeInvalidCredentials)
 }
 
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
-	message := "invalid or missing authentication token"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, codeInvalidAuthenticationToken)
 }
 
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
-	message := "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, codeAuthenticationRequired)
 }
 
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your user account must be activated to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, codeInactiveAccount)
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your user account doesn't have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, codeNotPermitted)
+}
+
+func (app *application) externalAuthFailedResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusUnauthorized, codeExternalAuthFailed)
+}
+
+func (app *application) identityConflictResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusConflict, codeIdentityConflict)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"DotaReplays/internal/jsonlog"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLogErrorOmitsQuery checks that a failed sign-in callback does not write
+// its code and state to the log.
+func TestLogErrorOmitsQuery(t *testing.T) {
+	ta := newTestApplication(t, nil)
+	var buf bytes.Buffer
+	ta.logger = jsonlog.New(&buf, jsonlog.LevelDebug)
+	r := httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/dev/callback?code=SECRETCODE&state=SECRETSTATE", nil)
+	w := httptest.NewRecorder()
+	ta.serverErrorResponse(w, r, errors.New("token endpoint unreachable"))
+
+	entry := buf.String()
+	if !strings.Contains(entry, `"request_path":"/v1/auth/oidc/dev/callback"`) {
+		t.Errorf("log entry %s does not name the path", entry)
+	}
+	if strings.Contains(entry, "SECRET") {
+		t.Errorf("log entry %s carries the query", entry)
+	}
+}
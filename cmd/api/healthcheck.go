@@ -1,19 +1,131 @@
 package main
 
 import (
+	"DotaReplays/internal/jsonlog"
+	"DotaReplays/internal/mailer"
+	"context"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// readinessTimeout bounds each dependency check, so that a hanging dependency
+// makes the instance not ready rather than the probe time out.
+const readinessTimeout = 2 * time.Second
+
+type dependency struct {
+	name string
+	// A dependency that is not critical is reported but does not make the
+	// instance not ready.
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+type dependencyStatus struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// healthcheckHandler reports the same as readinessHandler, with the version
+// and environment, for clients that predate the separate probes.
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	checks, ready := app.checkDependencies(r.Context())
+	status, code := "available", http.StatusOK
+	if !ready || app.shuttingDown.Load() {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
 	env := envelope{
-		"status": "available",
+		"status": status,
+		"checks": checks,
 		"system_info": map[string]string{
 			"environment": app.config.env,
 			"version":     version,
 		},
 	}
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	err := app.writeResponse(w, r, code, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// livenessHandler reports only that the process is serving requests; a
+// failing dependency is no reason to restart it.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// dependencies lists what the health checks look at. Mail is not critical, as
+// emails wait in the outbox and are retried until the backend is back.
+func (app *application) dependencies() []dependency {
+	deps := []dependency{{name: "database", critical: true, check: app.models.Ping}}
+	if checker, ok := app.mailer.(mailer.Checker); ok {
+		deps = append(deps, dependency{name: "mail", check: checker.Check})
+	}
+	return deps
+}
+
+// readinessHandler checks every dependency at once and responds 503 Service
+// Unavailable if a critical one is down or shutdown has begun, so that load
+// balancers stop sending traffic to the instance.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if app.shuttingDown.Load() {
+		err := app.writeResponse(w, r, http.StatusServiceUnavailable, envelope{"status": "shutting_down"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	checks, ready := app.checkDependencies(r.Context())
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	err := app.writeResponse(w, r, code, envelope{"status": status, "checks": checks}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// checkDependencies checks every dependency at once, reporting each by name
+// and whether all the critical ones are up.
+func (app *application) checkDependencies(ctx context.Context) (map[string]dependencyStatus, bool) {
+	deps := app.dependencies()
+	statuses := make([]dependencyStatus, len(deps))
+	var wg sync.WaitGroup
+	for i, dep := range deps {
+		wg.Add(1)
+		go func(i int, dep dependency) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+			start := time.Now()
+			err := dep.check(ctx)
+			statuses[i] = dependencyStatus{
+				Status:    "up",
+				Critical:  dep.critical,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			// The error can name internal hosts, so it is logged rather
+			// than sent to whoever asked.
+			if err != nil {
+				statuses[i].Status = "down"
+				app.logger.Warn("dependency check failed", jsonlog.String("dependency", dep.name), jsonlog.Err(err))
+			}
+		}(i, dep)
+	}
+	wg.Wait()
+
+	ready := true
+	checks := make(map[string]dependencyStatus, len(deps))
+	for i, dep := range deps {
+		checks[dep.name] = statuses[i]
+		if dep.critical && statuses[i].Status != "up" {
+			ready = false
+		}
+	}
+	return checks, ready
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+// TestHealthcheckDatabaseDown checks that both health checks report an
+// instance whose database cannot be reached as unavailable.
+func TestHealthcheckDatabaseDown(t *testing.T) {
+	// Nothing listens on port 1, so every connection is refused.
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ta := newTestApplication(t, db)
+
+	for path, want := range map[string]string{"/v1/healthcheck": "unavailable", "/v1/healthcheck/ready": "not_ready"} {
+		status, res := ta.do(t, http.MethodGet, path, "", nil)
+		if status != http.StatusServiceUnavailable || res["status"] != want {
+			t.Errorf("%s: got %d %v, want %d %s", path, status, res["status"], http.StatusServiceUnavailable, want)
+		}
+		checks, _ := res["checks"].(map[string]any)
+		database, _ := checks["database"].(map[string]any)
+		if database["status"] != "down" {
+			t.Errorf("%s: got database check %v, want down", path, database)
+		}
+	}
+}
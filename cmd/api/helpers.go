@@ -1,12 +1,15 @@
 package main
 
 import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/i18n"
 	"DotaReplays/internal/validator"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -24,19 +27,30 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	mediaType := app.contextGetMediaType(r)
+	body, err := app.encode(r, mediaType, data)
+	if errors.Is(err, errNotAcceptable) {
+		app.notAcceptableResponse(w, r)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	js = append(js, '\n')
+	app.write(w, status, mediaType, body, headers)
+	return nil
+}
+
+func (app *application) write(w http.ResponseWriter, status int, mediaType string, body []byte, headers http.Header) {
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
-	w.Header().Set("Content-Type", "application/json")
+	if mediaType == mediaTypeCSV {
+		mediaType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", mediaType)
 	w.WriteHeader(status)
-	w.Write(js)
-	return nil
+	w.Write(body)
 }
 
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
@@ -52,21 +66,21 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 		var maxBytesError *http.MaxBytesError
 		switch {
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+			return i18n.Errorf("body_malformed_at", syntaxError.Offset)
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+			return i18n.Errorf("body_malformed")
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return i18n.Errorf("body_wrong_type_field", unmarshalTypeError.Field)
 			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+			return i18n.Errorf("body_wrong_type_at", unmarshalTypeError.Offset)
 		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+			return i18n.Errorf("body_empty")
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+			return i18n.Errorf("body_unknown_key", fieldName)
 		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			return i18n.Errorf("body_too_large", maxBytesError.Limit)
 		case errors.As(err, &invalidUnmarshalError):
 			panic(err)
 		default:
@@ -75,7 +89,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	}
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must only contain a single JSON value")
+		return i18n.Errorf("body_multiple_values")
 	}
 	return nil
 }
@@ -103,16 +117,55 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddError(key, "integer")
 		return defaultValue
 	}
 	return i
 }
 
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "number")
+		return defaultValue
+	}
+	// ParseFloat reads "Inf" and "NaN", which no caller can use.
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		v.AddError(key, "finite")
+		return defaultValue
+	}
+	return f
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "boolean")
+		return defaultValue
+	}
+	return b
+}
+
+func (app *application) readRuntimeFormat(qs url.Values, v *validator.Validator) data.RuntimeFormat {
+	f := app.readString(qs, "runtime_format", string(data.RuntimeMinutes))
+	v.Check(validator.PermittedValue(f, data.RuntimeFormats...), "runtime_format", "oneof", strings.Join(data.RuntimeFormats, ", "))
+	return data.RuntimeFormat(f)
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
+	app.metrics.background.With().Inc()
 	go func() {
 		defer app.wg.Done()
+		defer app.metrics.background.With().Dec()
 		defer func() {
 			if err := recover(); err != nil {
 				app.logger.PrintError(fmt.Errorf("%s", err), nil)
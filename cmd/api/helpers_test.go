@@ -0,0 +1,36 @@
+package main
+
+import (
+	"DotaReplays/internal/validator"
+	"net/url"
+	"testing"
+)
+
+func TestReadFloat(t *testing.T) {
+	app := &application{}
+	tests := []struct {
+		in   string
+		want float64
+		code string
+	}{
+		{"", 0.5, ""},
+		{"2", 2, ""},
+		{"-1.25", -1.25, ""},
+		{"heavy", 0.5, "number"},
+		{"1e400", 0.5, "number"},
+		{"Inf", 0.5, "finite"},
+		{"-infinity", 0.5, "finite"},
+		{"NaN", 0.5, "finite"},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		got := app.readFloat(url.Values{"weight": {tt.in}}, "weight", 0.5, v)
+		var code string
+		if errs := v.Errors["weight"]; len(errs) > 0 {
+			code = errs[0].Code
+		}
+		if got != tt.want || code != tt.code {
+			t.Errorf("readFloat(%q) = %v with error %q, want %v with %q", tt.in, got, code, tt.want, tt.code)
+		}
+	}
+}
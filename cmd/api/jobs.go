@@ -0,0 +1,144 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/jobs"
+	"DotaReplays/internal/trace"
+	"DotaReplays/internal/validator"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const jobSendEmail = "email.send"
+
+type emailJob struct {
+	OutboxID int64 `json:"outbox_id"`
+}
+
+func (app *application) registerJobs() {
+	jobs.Handle(app.queue, jobSendEmail, app.sendEmailJob)
+	jobs.OnDead(app.queue, jobSendEmail, app.abandonEmailJob)
+}
+
+// sendEmailJob delivers one outbox message. Delivery is at least once: if the
+// message is sent but cannot be marked as such, the retry sends it again.
+func (app *application) sendEmailJob(ctx context.Context, payload emailJob) (err error) {
+	ctx, span := app.tracer.Start(ctx, "job "+jobSendEmail)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	models := app.models.WithContext(ctx)
+	email, err := models.EmailOutbox.Get(payload.OutboxID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return jobs.Permanent(err)
+		default:
+			return err
+		}
+	}
+	switch email.Status {
+	case data.EmailSent:
+		return nil
+	case data.EmailAbandoned:
+		// The tokens the message carried are gone, so retrying a dead job
+		// cannot send it; whatever triggered it has to be done again.
+		return jobs.Permanent(errors.New("email was abandoned and its data discarded"))
+	}
+	_, sendSpan := trace.Start(ctx, "mail send", trace.KindClient)
+	sendSpan.SetAttribute("email.template", email.Template)
+	err = app.mailer.Send(email.Recipient, email.Locale, email.Template, email.Data)
+	sendSpan.RecordError(err)
+	sendSpan.End()
+	if err != nil {
+		app.metrics.emails.With(email.Template, "failure").Inc()
+		if markErr := models.EmailOutbox.MarkFailed(email, err.Error()); markErr != nil {
+			app.logger.PrintError(markErr, nil)
+		}
+		return err
+	}
+	app.metrics.emails.With(email.Template, "success").Inc()
+	return models.EmailOutbox.MarkSent(email)
+}
+
+// abandonEmailJob discards the data of a message the queue has given up on,
+// so that its plaintext tokens are not kept in the outbox.
+func (app *application) abandonEmailJob(ctx context.Context, payload emailJob) error {
+	return app.models.WithContext(ctx).EmailOutbox.Abandon(payload.OutboxID)
+}
+
+// sendEmail records an email in the outbox and queues its delivery, both in
+// the transaction tx is bound to, so nothing is sent unless the change that
+// triggered the email commits.
+func (app *application) sendEmail(tx data.Models, user *data.User, templateFile string, templateData map[string]any) error {
+	email := &data.Email{
+		UserID:    &user.ID,
+		Recipient: user.Email,
+		Locale:    user.Locale,
+		Template:  templateFile,
+		Data:      templateData,
+	}
+	err := tx.EmailOutbox.Insert(email)
+	if err != nil {
+		return err
+	}
+	_, err = app.queue.EnqueueTx(tx, jobSendEmail, emailJob{OutboxID: email.ID})
+	return err
+}
+
+func (app *application) listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		Kind   string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", "")
+	input.Kind = app.readString(qs, "kind", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-updated_at")
+	input.Filters.SortSafelist = []string{"id", "run_at", "updated_at", "attempts", "-id", "-run_at", "-updated_at", "-attempts"}
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, data.JobStatuses...), "status", "oneof", strings.Join(data.JobStatuses, ", "))
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	jobs, metadata, err := app.modelsFor(r).Jobs.GetAll(input.Status, input.Kind, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"jobs": jobs, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) retryJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	job, err := app.modelsFor(r).Jobs.Retry(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"job": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
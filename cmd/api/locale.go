@@ -0,0 +1,41 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/i18n"
+	"DotaReplays/internal/validator"
+	"errors"
+	"net/http"
+)
+
+// locale picks the language for a response: the authenticated user's saved
+// preference first, then the Accept-Language header, then English.
+func (app *application) locale(r *http.Request) string {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if ok && !user.IsAnonymous() && i18n.IsSupported(user.Locale) {
+		return user.Locale
+	}
+	if locale := i18n.Match(r.Header.Get("Accept-Language")); locale != "" {
+		return locale
+	}
+	return i18n.DefaultLocale
+}
+
+func (app *application) translateError(r *http.Request, err error) string {
+	var message *i18n.Message
+	if errors.As(err, &message) {
+		return message.Translate(app.locale(r))
+	}
+	return err.Error()
+}
+
+func (app *application) translateValidationErrors(r *http.Request, errors map[string][]validator.Error) map[string][]string {
+	locale := app.locale(r)
+	translated := make(map[string][]string, len(errors))
+	for field, fieldErrors := range errors {
+		for _, e := range fieldErrors {
+			translated[field] = append(translated[field], i18n.Translate(locale, e.Code, e.Args...))
+		}
+	}
+	return translated
+}
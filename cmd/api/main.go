@@ -2,13 +2,22 @@ package main
 
 import (
 	"DotaReplays/internal/data"
+	"DotaReplays/internal/jobs"
 	"DotaReplays/internal/jsonlog"
+	"DotaReplays/internal/jwt"
 	"DotaReplays/internal/mailer"
+	"DotaReplays/internal/openid"
+	"DotaReplays/internal/trace"
 	"context"      // New import
 	"database/sql" // New import
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 	// Import the pq driver so that it can register itself with the database/sql
 	// package. Note that we alias this import to the blank identifier, to stop the Go
@@ -19,19 +28,70 @@ import (
 const version = "1.0.0"
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port          int
+	env           string
+	baseURL       string
+	shutdownDelay time.Duration
+	db            struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
-		maxIdleTime  string
+		maxIdleTime  time.Duration
+		autoMigrate  bool
+	}
+	admin struct {
+		addr string
+		port int
+	}
+	log struct {
+		level            jsonlog.Level
+		file             string
+		fileLevel        jsonlog.Level
+		fileMaxSize      int64
+		fileMaxBackups   int
+		sampleFirst      int
+		sampleThereafter int
 	}
 	limiter struct {
 		enabled bool
 		rps     float64
 		burst   int
 	}
+	similar struct {
+		heroesWeight float64
+		patchWeight  float64
+		yearWeight   float64
+	}
+	export struct {
+		writeTimeout time.Duration
+	}
+	jobs struct {
+		workers      int
+		pollInterval time.Duration
+		timeout      time.Duration
+		maxAttempts  int
+	}
+	mailer struct {
+		backend string
+		dir     string
+		brand   string
+	}
+	steam struct {
+		endpoint string
+	}
+	oidc struct {
+		configFile string
+	}
+	trace struct {
+		exporter string
+		file     string
+	}
+	accessTokens struct {
+		keysDir    string
+		keyID      string
+		ttl        time.Duration
+		refreshTTL time.Duration
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -42,50 +102,250 @@ type config struct {
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *jsonlog.Logger
+	models  data.Models
+	metrics *appMetrics
+	mailer  mailer.Mailer
+	emails  *mailer.Renderer
+	queue   *jobs.Queue
+	tracer  *trace.Tracer
+	steam   *openid.Provider
+	oidc    map[string]*oidcProvider
+	// accessTokens signs and verifies access tokens. It is nil, and the
+	// access token endpoints are not routed, unless -access-token-keys is set.
+	accessTokens *jwt.KeySet
+	// shuttingDown is set as soon as shutdown begins, so that readiness
+	// checks fail while in-flight requests drain.
+	shuttingDown atomic.Bool
+	wg           sync.WaitGroup
 }
 
 func main() {
 	var cfg config
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
+	flag.StringVar(&cfg.admin.addr, "admin-addr", "127.0.0.1", "Address the admin server listens on; it has no authentication, so widen it only to a private network (0.0.0.0 for every interface)")
+	flag.IntVar(&cfg.admin.port, "admin-port", 4001, "Admin server port for /metrics, /log/level and health probes, keep it private (0 to disable)")
+	flag.TextVar(&cfg.log.level, "log-level", jsonlog.LevelInfo, "Minimum log level (debug|info|warn|error|fatal|off), also settable at runtime on the admin port")
+	flag.StringVar(&cfg.log.file, "log-file", "", "Also write logs to this size-rotated file")
+	flag.TextVar(&cfg.log.fileLevel, "log-file-level", jsonlog.LevelDebug, "Minimum level written to the log file")
+	flag.Int64Var(&cfg.log.fileMaxSize, "log-file-max-size", 100, "Size in megabytes at which the log file is rotated")
+	flag.IntVar(&cfg.log.fileMaxBackups, "log-file-max-backups", 5, "Rotated log files to keep")
+	flag.IntVar(&cfg.log.sampleFirst, "log-sample-first", 0, "Entries with the same level and message logged each second before sampling (0 disables sampling)")
+	flag.IntVar(&cfg.log.sampleThereafter, "log-sample-thereafter", 100, "Once sampling, log every Nth entry with the same level and message")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DOTAREPLAYS_DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.baseURL, "base-url", "http://localhost:4000", "Public base URL of the API, used in links and redirects")
+	flag.DurationVar(&cfg.shutdownDelay, "shutdown-delay", 0, "How long to keep serving after a shutdown signal while readiness checks fail, so load balancers can stop routing here first")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+	flag.BoolVar(&cfg.db.autoMigrate, "db-auto-migrate", false, "Apply pending database migrations on start")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.Float64Var(&cfg.similar.heroesWeight, "similar-heroes-weight", 1, "Similar replays hero overlap weight")
+	flag.Float64Var(&cfg.similar.patchWeight, "similar-patch-weight", 0.5, "Similar replays patch proximity weight")
+	flag.Float64Var(&cfg.similar.yearWeight, "similar-year-weight", 0.25, "Similar replays year proximity weight")
+
+	flag.DurationVar(&cfg.export.writeTimeout, "export-write-timeout", 30*time.Second, "Maximum time allowed between two flushes of a replay export")
+
+	flag.IntVar(&cfg.jobs.workers, "jobs-workers", 2, "Number of background job workers")
+	flag.DurationVar(&cfg.jobs.pollInterval, "jobs-poll-interval", time.Second, "How often idle job workers poll for due jobs")
+	flag.DurationVar(&cfg.jobs.timeout, "jobs-timeout", time.Minute, "Maximum time a single job may run")
+	flag.IntVar(&cfg.jobs.maxAttempts, "jobs-max-attempts", 5, "Attempts before a failing job is marked dead")
+
+	flag.StringVar(&cfg.mailer.backend, "mailer", "", "Mail backend (smtp|file|log); defaults to log with -env=development and smtp otherwise")
+	flag.StringVar(&cfg.mailer.dir, "mailer-dir", "./tmp/mail", "Directory the file mail backend writes .eml files to")
+	flag.StringVar(&cfg.mailer.brand, "mailer-brand", "DotaReplays", "Product name used in emails")
+
+	flag.StringVar(&cfg.steam.endpoint, "steam-openid-endpoint", "https://steamcommunity.com/openid/login", "Steam OpenID 2.0 provider endpoint")
+	flag.StringVar(&cfg.oidc.configFile, "oidc-config", "", "JSON file listing OpenID Connect single sign-on providers")
 
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "smtp.office365.com", "SMTP host")
+	flag.StringVar(&cfg.trace.exporter, "trace-exporter", "none", "Where to write trace spans as OTLP-JSON (none|stdout|file)")
+	flag.StringVar(&cfg.trace.file, "trace-file", "./tmp/traces.jsonl", "File the file trace exporter appends to")
+
+	flag.StringVar(&cfg.accessTokens.keysDir, "access-token-keys", "", "Directory of Ed25519 <kid>.pem keys for signed access tokens (disabled if empty)")
+	flag.StringVar(&cfg.accessTokens.keyID, "access-token-key-id", "", "ID of the key that signs new access tokens (default the last private key by name)")
+	flag.DurationVar(&cfg.accessTokens.ttl, "access-token-ttl", 15*time.Minute, "Lifetime of signed access tokens")
+	flag.DurationVar(&cfg.accessTokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", "211634@astanait.edu.kz", "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", "kaismal2003", "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "DotaReplays <211634@astanait.edu.kz>", "SMTP sender")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "DotaReplays <no-reply@localhost>", "Sender address of outgoing email")
+
+	configFile := flag.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML or TOML config file; every flag can also be set there or as a DOTAREPLAYS_* environment variable")
+	printCfg := flag.Bool("print-config", false, "Print the effective configuration with secrets redacted and exit")
 	flag.Parse()
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	err := loadConfig(flag.CommandLine, *configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// The log mailer writes tokens to the log, so it is only the default
+	// where that is harmless.
+	if cfg.mailer.backend == "" {
+		backend := "smtp"
+		if cfg.env == "development" {
+			backend = "log"
+		}
+		flag.Set("mailer", backend)
+	}
+	// The configuration is printed even when it is invalid, as that is when
+	// it is most useful to see.
+	if *printCfg {
+		err := printConfig(os.Stdout, flag.CommandLine)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	// The migrate subcommand only needs the database and the log, so the
+	// rest of the configuration is neither checked nor loaded for it.
+	validate := cfg.validate
+	if flag.NArg() > 0 {
+		validate = cfg.validateMigrate
+	}
+	err = validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *printCfg {
+		return
+	}
+	logger, logFile, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	slog.SetDefault(slog.New(logger.Handler()))
+	if flag.NArg() > 0 {
+		err = runCommand(cfg, logger, flag.Args())
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	}
+	oidcProviders, err := loadOIDCProviders(cfg.oidc.configFile, cfg.baseURL)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	var accessTokens *jwt.KeySet
+	if cfg.accessTokens.keysDir != "" {
+		accessTokens, err = jwt.LoadDir(cfg.accessTokens.keysDir, cfg.accessTokens.keyID)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+	tracer, traceFile, err := newTracer(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if traceFile != nil {
+		defer traceFile.Close()
+	}
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 	defer db.Close()
 	logger.PrintInfo("database connection pool established", nil)
+	if cfg.db.autoMigrate {
+		err = autoMigrate(db, logger)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+	renderer := &mailer.Renderer{
+		Sender:  cfg.smtp.sender,
+		Brand:   cfg.mailer.brand,
+		BaseURL: cfg.baseURL,
+	}
+	mail, err := newMailer(cfg, renderer, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	models := data.NewModels(db)
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:       cfg,
+		logger:       logger,
+		models:       models,
+		metrics:      newMetrics(db),
+		mailer:       mail,
+		emails:       renderer,
+		tracer:       tracer,
+		steam:        openid.New(cfg.steam.endpoint),
+		oidc:         oidcProviders,
+		accessTokens: accessTokens,
+		queue: jobs.New(models.Jobs, logger, jobs.Config{
+			Workers:      cfg.jobs.workers,
+			PollInterval: cfg.jobs.pollInterval,
+			Timeout:      cfg.jobs.timeout,
+			MaxAttempts:  cfg.jobs.maxAttempts,
+		}),
+	}
+	// Outgoing calls to identity providers join the trace of the request
+	// that made them.
+	app.steam.Client.Transport = &trace.Transport{Base: app.steam.Client.Transport}
+	for _, provider := range app.oidc {
+		provider.Client.Transport = &trace.Transport{Base: provider.Client.Transport}
 	}
+	app.registerJobs()
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 }
 
+// newLogger returns the logger for cfg, and the log file it writes to if that
+// needs closing on shutdown.
+func newLogger(cfg config) (*jsonlog.Logger, io.Closer, error) {
+	logCfg := jsonlog.Config{
+		Level: cfg.log.level,
+		Sinks: []jsonlog.Sink{{Writer: os.Stdout}},
+	}
+	var closer io.Closer
+	if cfg.log.file != "" {
+		f, err := jsonlog.OpenRotatingFile(cfg.log.file, cfg.log.fileMaxSize<<20, cfg.log.fileMaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		logCfg.Sinks = append(logCfg.Sinks, jsonlog.Sink{Writer: f, MinLevel: cfg.log.fileLevel})
+		closer = f
+	}
+	if cfg.log.sampleFirst > 0 {
+		logCfg.Sampling = &jsonlog.Sampling{
+			Interval:   time.Second,
+			First:      cfg.log.sampleFirst,
+			Thereafter: cfg.log.sampleThereafter,
+		}
+	}
+	return jsonlog.NewWithConfig(logCfg), closer, nil
+}
+
+func newMailer(cfg config, renderer *mailer.Renderer, logger *jsonlog.Logger) (mailer.Mailer, error) {
+	switch cfg.mailer.backend {
+	case "smtp":
+		return mailer.NewSMTP(renderer, cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password), nil
+	case "file":
+		return mailer.NewFile(renderer, cfg.mailer.dir)
+	case "log":
+		return mailer.NewLog(renderer, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %q", cfg.mailer.backend)
+	}
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
@@ -95,11 +355,7 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	db.SetMaxIdleConns(cfg.db.maxIdleConns)
 
-	duration, err := time.ParseDuration(cfg.db.maxIdleTime)
-	if err != nil {
-		return nil, err
-	}
-	db.SetConnMaxIdleTime(duration)
+	db.SetConnMaxIdleTime(cfg.db.maxIdleTime)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	err = db.PingContext(ctx)
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"DotaReplays/internal/metrics"
+	"database/sql"
+	"net/http"
+	"runtime"
+)
+
+// appMetrics are the metrics served on the admin port.
+type appMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	rateLimited     *metrics.CounterVec
+	background      *metrics.GaugeVec
+	emails          *metrics.CounterVec
+}
+
+func newMetrics(db *sql.DB) *appMetrics {
+	r := metrics.NewRegistry()
+	m := &appMetrics{
+		registry:        r,
+		requests:        r.NewCounterVec("http_requests_total", "HTTP requests served, by method, route and status.", "method", "route", "status"),
+		requestDuration: r.NewHistogramVec("http_request_duration_seconds", "Time taken to serve HTTP requests, by method, route and status.", metrics.DefaultBuckets, "method", "route", "status"),
+		rateLimited:     r.NewCounterVec("http_rate_limited_total", "Requests rejected by the rate limiter."),
+		background:      r.NewGaugeVec("background_goroutines", "Background goroutines that shutdown waits for."),
+		emails:          r.NewCounterVec("emails_sent_total", "Emails handed to the mail backend, by template and result.", "template", "result"),
+	}
+	// Export the unlabelled series as zero before anything happens.
+	m.rateLimited.With()
+	m.background.With()
+	r.NewGaugeFunc("go_goroutines", "Goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	dbGauge := func(name, help string, fn func(sql.DBStats) float64) {
+		r.NewGaugeFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+	dbCounter := func(name, help string, fn func(sql.DBStats) float64) {
+		r.NewCounterFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+	dbGauge("db_max_open_connections", "Maximum number of open connections to the database.", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	dbGauge("db_open_connections", "Open connections to the database, in use or idle.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	dbGauge("db_in_use_connections", "Database connections currently in use.", func(s sql.DBStats) float64 { return float64(s.InUse) })
+	dbGauge("db_idle_connections", "Idle database connections.", func(s sql.DBStats) float64 { return float64(s.Idle) })
+	dbCounter("db_wait_count_total", "Times a query waited for a free database connection.", func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	dbCounter("db_wait_duration_seconds_total", "Total time spent waiting for a free database connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	dbCounter("db_max_idle_closed_total", "Connections closed because of the idle connection limit.", func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	dbCounter("db_max_idle_time_closed_total", "Connections closed because they were idle too long.", func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })
+	dbCounter("db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.", func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+	return m
+}
+
+// metricsMethod folds unknown methods into one label value, as clients can
+// send anything.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
@@ -2,23 +2,161 @@ package main
 
 import (
 	"DotaReplays/internal/data"
+	"DotaReplays/internal/jsonlog"
+	"DotaReplays/internal/trace"
 	"DotaReplays/internal/validator"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"golang.org/x/time/rate"
 	"net"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// requestIDRX limits the request IDs accepted from clients and proxies to
+// ones that are safe to log and echo back.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID keeps the X-Request-ID sent by the client or an upstream proxy, or
+// assigns a new one, so that a request can be followed through every log line
+// and error response it produces.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(requestID) {
+			b := make([]byte, 16)
+			_, err := rand.Read(b)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			requestID = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		r = app.contextSetRequestID(r, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestInfo collects what inner handlers learn about a request, which the
+// access log and metrics need once it has been served: the route pattern the
+// router matched and the ID of the authenticated user.
+type requestInfo struct {
+	route  string
+	userID int64
+}
+
+// statusWriter records the status code and the number of body bytes written
+// through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which the
+// replay export relies on to flush.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// logRequests writes one access log line per request and records its metrics.
+func (app *application) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{route: "unmatched"}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoContextKey, info))
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			duration := time.Since(start)
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			labels := []string{metricsMethod(r.Method), info.route, strconv.Itoa(status)}
+			app.metrics.requests.With(labels...).Inc()
+			app.metrics.requestDuration.With(labels...).Observe(duration.Seconds())
+
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			fields := []jsonlog.Field{
+				jsonlog.String("request_id", app.contextGetRequestID(r)),
+				jsonlog.String("method", r.Method),
+				jsonlog.String("route", info.route),
+				jsonlog.Int("status", status),
+				jsonlog.Int64("bytes", sw.bytes),
+				jsonlog.Duration("duration", duration),
+				jsonlog.String("ip", ip),
+			}
+			if span := trace.SpanFromContext(r.Context()); span != nil {
+				fields = append(fields, jsonlog.String("trace_id", span.TraceID()))
+			}
+			if info.userID != 0 {
+				fields = append(fields, jsonlog.Int64("user_id", info.userID))
+			}
+			app.logger.Info("request", fields...)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// routePattern records pattern as the route of requests handled by next, so
+// that logs, metrics and traces name the route rather than the path, which
+// would give every replay ID its own metric series. It also starts the
+// handler's span.
+func (app *application) routePattern(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+			info.route = pattern
+		}
+		root := trace.SpanFromContext(r.Context())
+		root.SetName(r.Method + " " + pattern)
+		root.SetAttribute("http.route", pattern)
+		ctx, span := trace.Start(r.Context(), "handler "+pattern)
+		defer span.End()
+		next(w, r.WithContext(ctx))
+	}
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				// A handler aborts a response it has already started, such
+				// as an export that failed midway, so that the client sees a
+				// broken connection rather than a complete body. net/http
+				// handles that panic without logging a stack trace.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
 				w.Header().Set("Connection", "close")
-				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
+				app.logError(r, fmt.Errorf("%s", err), jsonlog.Stack())
+				app.errorResponse(w, r, http.StatusInternalServerError, codeServerError)
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -67,6 +205,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 			clients[ip].lastSeen = time.Now()
 			if !clients[ip].limiter.Allow() {
 				mu.Unlock()
+				app.metrics.rateLimited.With().Inc()
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
@@ -97,6 +236,26 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		// Signed access tokens carry everything needed to serve the request,
+		// so the database is not consulted for them.
+		if app.accessTokens != nil && strings.Count(token, ".") == 2 {
+			var claims accessClaims
+			err := app.accessTokens.Verify(token, app.config.baseURL, &claims)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			id, err := strconv.ParseInt(claims.Subject, 10, 64)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			r = app.contextSetUser(r, &data.User{ID: id, Activated: claims.Activated, Locale: claims.Locale})
+			r = app.contextSetPermissions(r, claims.Permissions)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -104,7 +263,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.modelsFor(r).Users.GetForToken(data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -144,13 +303,39 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 	return app.requireAuthenticatedUser(fn)
 }
 
+// requireUserRecord swaps the user in the context for their stored record
+// when the request was authenticated with a signed access token, which only
+// carries the user's ID, activation status and locale. Handlers that read or
+// update the rest of the user need it.
+func (app *application) requireUserRecord(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := app.contextGetPermissions(r); ok {
+			user, err := app.modelsFor(r).Users.Get(app.contextGetUser(r).ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetUser(r, user)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		user := app.contextGetUser(r)
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+			permissions, err = app.modelsFor(r).Permissions.GetAllForUser(app.contextGetUser(r).ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 		}
 		if !permissions.Include(code) {
 			app.notPermittedResponse(w, r)
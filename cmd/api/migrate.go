@@ -0,0 +1,119 @@
+package main
+
+import (
+	"DotaReplays/internal/jsonlog"
+	"DotaReplays/internal/migrate"
+	"DotaReplays/migrations"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: api [flags] migrate up | down [N] | to VERSION | status"
+
+// errUsage is returned for a malformed subcommand, which main reports with
+// the usage line rather than as a log entry.
+var errUsage = errors.New(migrateUsage)
+
+// runCommand runs the subcommand in args; migrate is the only one.
+func runCommand(cfg config, logger *jsonlog.Logger, args []string) error {
+	if args[0] != "migrate" {
+		return errUsage
+	}
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	logger.PrintInfo("database connection pool established", nil)
+	return migrateCommand(db, logger, args[1:])
+}
+
+// migrateCommand runs the migrate subcommand. Migrations can take a while, so
+// they run without the usual per-query timeout.
+func migrateCommand(db *sql.DB, logger *jsonlog.Logger, args []string) error {
+	mr, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if len(args) == 0 {
+		return errUsage
+	}
+	var done []migrate.Step
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		done, err = mr.Up(ctx)
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errUsage
+			}
+		}
+		done, err = mr.Down(ctx, steps)
+	case args[0] == "to" && len(args) == 2:
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil || version < 0 {
+			return errUsage
+		}
+		done, err = mr.To(ctx, version)
+	case args[0] == "status" && len(args) == 1:
+		return printMigrationStatus(ctx, mr)
+	default:
+		return errUsage
+	}
+	logMigrations(logger, done, err)
+	return err
+}
+
+// logMigrations logs the steps that were done before err, if any, stopped the
+// run. The schema is only reported up to date when nothing failed.
+func logMigrations(logger *jsonlog.Logger, done []migrate.Step, err error) {
+	for _, step := range done {
+		message := "migration applied"
+		if step.Reverted {
+			message = "migration reverted"
+		}
+		logger.Info(message, jsonlog.Int64("version", step.Version), jsonlog.String("name", step.Name))
+	}
+	if len(done) == 0 && err == nil {
+		logger.Info("database schema is up to date")
+	}
+}
+
+func printMigrationStatus(ctx context.Context, mr *migrate.Migrator) error {
+	statuses, err := mr.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%06d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
+
+// autoMigrate applies pending migrations on start, for deployments that do
+// not run `api migrate up` as a separate step. Concurrent instances wait for
+// each other on the migration lock.
+func autoMigrate(db *sql.DB, logger *jsonlog.Logger) error {
+	mr, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	done, err := mr.Up(context.Background())
+	logMigrations(logger, done, err)
+	return err
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"DotaReplays/internal/msgpack"
+	"DotaReplays/internal/replayio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	mediaTypeJSON    = "application/json"
+	mediaTypeMsgpack = "application/msgpack"
+	mediaTypeCSV     = "text/csv"
+	mediaTypeNDJSON  = "application/x-ndjson"
+)
+
+var errNotAcceptable = errors.New("not acceptable")
+
+// objectMediaTypes can encode any response, in order of preference. They are
+// all that endpoints which write, or return a single object, offer.
+var objectMediaTypes = []string{mediaTypeJSON, mediaTypeMsgpack, "application/x-msgpack", "application/vnd.msgpack"}
+
+// listMediaTypes are offered by list endpoints, whose envelope holds a single
+// list that can also be rendered as CSV.
+var listMediaTypes = append(objectMediaTypes[:len(objectMediaTypes):len(objectMediaTypes)], mediaTypeCSV)
+
+// exportMediaTypes are the formats the replay export streams.
+var exportMediaTypes = []string{mediaTypeNDJSON, mediaTypeCSV}
+
+// offeredMediaTypes lists everything the API can produce, for requests that
+// have not been routed yet.
+var offeredMediaTypes = append(listMediaTypes[:len(listMediaTypes):len(listMediaTypes)], mediaTypeNDJSON)
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// negotiate returns the offer with the highest quality in the Accept header,
+// preferring earlier offers on ties, or "" if none of them is acceptable. The
+// most specific matching range decides the quality of each offer.
+func negotiate(header string, offers ...string) string {
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		offerType, _, _ := strings.Cut(offer, "/")
+		q, specificity := 0.0, -1
+		for _, ar := range ranges {
+			rangeType, rangeSubtype, _ := strings.Cut(ar.mediaType, "/")
+			s := -1
+			switch {
+			case ar.mediaType == offer:
+				s = 2
+			case rangeType == offerType && rangeSubtype == "*":
+				s = 1
+			case ar.mediaType == "*/*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = ar.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	switch best {
+	case "application/x-msgpack", "application/vnd.msgpack":
+		return mediaTypeMsgpack
+	}
+	return best
+}
+
+// negotiateContent picks the media type of errors raised before a request
+// is routed, and refuses requests that no endpoint could answer. Each route
+// then narrows the choice to what it produces.
+func (app *application) negotiateContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		mediaType := negotiate(r.Header.Get("Accept"), offeredMediaTypes...)
+		if mediaType == "" {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+		r = app.contextSetMediaType(r, mediaType)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// produces negotiates among offers, the media types that next's responses
+// can be encoded in, and responds 406 Not Acceptable before next runs if
+// none of them is acceptable, so that a write is never carried out only for
+// its response to be refused.
+func (app *application) produces(offers []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType := negotiate(r.Header.Get("Accept"), offers...)
+		if mediaType == "" {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+		next(w, app.contextSetMediaType(r, mediaType))
+	}
+}
+
+func (app *application) encode(r *http.Request, mediaType string, data any) ([]byte, error) {
+	switch mediaType {
+	case mediaTypeJSON:
+		if r.URL.Query().Get("pretty") == "true" {
+			js, err := json.MarshalIndent(data, "", "\t")
+			return append(js, '\n'), err
+		}
+		js, err := json.Marshal(data)
+		return append(js, '\n'), err
+	case mediaTypeMsgpack:
+		return msgpack.Marshal(data)
+	case mediaTypeCSV:
+		env, ok := data.(envelope)
+		if !ok {
+			return nil, errNotAcceptable
+		}
+		return encodeCSV(env)
+	default:
+		return nil, errNotAcceptable
+	}
+}
+
+// encodeCSV renders the single list held by a list endpoint's envelope, one
+// row per element, with columns in the order the fields are first seen. Any
+// other shape of response cannot be represented as CSV.
+func encodeCSV(data envelope) ([]byte, error) {
+	var list any
+	for _, value := range data {
+		js, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(js) > 0 && js[0] == '[' {
+			if list != nil {
+				return nil, errNotAcceptable
+			}
+			list = json.RawMessage(js)
+		}
+	}
+	if list == nil {
+		return nil, errNotAcceptable
+	}
+	var items []json.RawMessage
+	err := json.Unmarshal(list.(json.RawMessage), &items)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	seen := make(map[string]bool)
+	rows := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		keys, values, err := decodeObject(item)
+		if err != nil {
+			return nil, errNotAcceptable
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+		rows = append(rows, values)
+	}
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	w.Write(columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = csvCell(row[column])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func decodeObject(js json.RawMessage) ([]string, map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	tok, err := dec.Token()
+	if err != nil || tok != json.Delim('{') {
+		return nil, nil, errNotAcceptable
+	}
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := tok.(string)
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values[key] = value
+	}
+	return keys, values, nil
+}
+
+func csvCell(js json.RawMessage) string {
+	if len(js) == 0 || string(js) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(js, &s) == nil {
+		return s
+	}
+	var list []string
+	if json.Unmarshal(js, &list) == nil {
+		return strings.Join(list, replayio.HeroSeparator)
+	}
+	return string(js)
+}
@@ -14,6 +14,7 @@ func (app *application) createReplayHandler(w http.ResponseWriter, r *http.Reque
 		Year    int32        `json:"year"`
 		Runtime data.Runtime `json:"runtime"`
 		Heroes  []string     `json:"heroes"`
+		Patch   string       `json:"patch"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -25,20 +26,22 @@ func (app *application) createReplayHandler(w http.ResponseWriter, r *http.Reque
 		Year:    input.Year,
 		Runtime: input.Runtime,
 		Heroes:  input.Heroes,
+		Patch:   input.Patch,
 	}
 	v := validator.New()
+	replay.SetRuntimeFormat(app.readRuntimeFormat(r.URL.Query(), v))
 	if data.ValidateReplay(v, replay); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Replays.Insert(replay)
+	err = app.modelsFor(r).Replays.Insert(replay)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/replays/%d", replay.ID))
-	err = app.writeJSON(w, http.StatusCreated, envelope{"replay": replay}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"replay": replay}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -50,7 +53,13 @@ func (app *application) showReplayHandler(w http.ResponseWriter, r *http.Request
 		app.notFoundResponse(w, r)
 		return
 	}
-	replay, err := app.models.Replays.Get(id)
+	v := validator.New()
+	runtimeFormat := app.readRuntimeFormat(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	replay, err := app.modelsFor(r).Replays.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -60,7 +69,8 @@ func (app *application) showReplayHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"replay": replay}, nil)
+	replay.SetRuntimeFormat(runtimeFormat)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"replay": replay}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -72,7 +82,7 @@ func (app *application) updateReplayHandler(w http.ResponseWriter, r *http.Reque
 		app.notFoundResponse(w, r)
 		return
 	}
-	replay, err := app.models.Replays.Get(id)
+	replay, err := app.modelsFor(r).Replays.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -87,6 +97,7 @@ func (app *application) updateReplayHandler(w http.ResponseWriter, r *http.Reque
 		Year    *int32        `json:"year"`
 		Runtime *data.Runtime `json:"runtime"`
 		Heroes  []string      `json:"heroes"`
+		Patch   *string       `json:"patch"`
 	}
 	err = app.readJSON(w, r, &input)
 	if err != nil {
@@ -106,12 +117,16 @@ func (app *application) updateReplayHandler(w http.ResponseWriter, r *http.Reque
 	if input.Heroes != nil {
 		replay.Heroes = input.Heroes
 	}
+	if input.Patch != nil {
+		replay.Patch = *input.Patch
+	}
 	v := validator.New()
+	replay.SetRuntimeFormat(app.readRuntimeFormat(r.URL.Query(), v))
 	if data.ValidateReplay(v, replay); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Replays.Update(replay)
+	err = app.modelsFor(r).Replays.Update(replay)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -121,7 +136,7 @@ func (app *application) updateReplayHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"replay": replay}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"replay": replay}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -136,7 +151,7 @@ func (app *application) deleteReplayHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Replays.Delete(id)
+	err = app.modelsFor(r).Replays.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -146,7 +161,7 @@ func (app *application) deleteReplayHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "replay successfully deleted"}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "replay successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -154,14 +169,16 @@ func (app *application) deleteReplayHandler(w http.ResponseWriter, r *http.Reque
 
 func (app *application) listReplaysHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Heroes []string
+		Title         string
+		Heroes        []string
+		RuntimeFormat data.RuntimeFormat
 		data.Filters
 	}
 	v := validator.New()
 	qs := r.URL.Query()
 	input.Title = app.readString(qs, "title", "")
 	input.Heroes = app.readCSV(qs, "heroes", []string{})
+	input.RuntimeFormat = app.readRuntimeFormat(qs, v)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
@@ -170,12 +187,65 @@ func (app *application) listReplaysHandler(w http.ResponseWriter, r *http.Reques
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	replays, metadata, err := app.models.Replays.GetAll(input.Title, input.Heroes, input.Filters)
+	replays, metadata, err := app.modelsFor(r).Replays.GetAll(input.Title, input.Heroes, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"replays": replays, "metadata": metadata}, nil)
+	for _, replay := range replays {
+		replay.SetRuntimeFormat(input.RuntimeFormat)
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"replays": replays, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSimilarReplaysHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	replay, err := app.modelsFor(r).Replays.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Weights       data.SimilarityWeights
+		RuntimeFormat data.RuntimeFormat
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.RuntimeFormat = app.readRuntimeFormat(qs, v)
+	input.Weights.Heroes = app.readFloat(qs, "heroes_weight", app.config.similar.heroesWeight, v)
+	input.Weights.Patch = app.readFloat(qs, "patch_weight", app.config.similar.patchWeight, v)
+	input.Weights.Year = app.readFloat(qs, "year_weight", app.config.similar.yearWeight, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-score")
+	input.Filters.SortSafelist = []string{"score", "id", "year", "-score", "-id", "-year"}
+	data.ValidateSimilarityWeights(v, input.Weights)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	similar, metadata, err := app.modelsFor(r).Replays.GetSimilar(replay, input.Weights, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, s := range similar {
+		s.Replay.SetRuntimeFormat(input.RuntimeFormat)
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"replays": similar, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/replayio"
+	"DotaReplays/internal/validator"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const exportFlushInterval = time.Second
+
+func exportFormat(r *http.Request, format string) string {
+	if format != "" {
+		return format
+	}
+	switch negotiate(r.Header.Get("Accept"), exportMediaTypes...) {
+	case mediaTypeNDJSON:
+		return "ndjson"
+	case mediaTypeCSV:
+		return "csv"
+	}
+	return ""
+}
+
+func (app *application) exportReplaysHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title         string
+		Heroes        []string
+		Format        string
+		RuntimeFormat data.RuntimeFormat
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Title = app.readString(qs, "title", "")
+	input.Heroes = app.readCSV(qs, "heroes", []string{})
+	input.Format = app.readString(qs, "format", "")
+	input.RuntimeFormat = app.readRuntimeFormat(qs, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	v.Check(validator.PermittedValue(input.Format, "", "csv", "ndjson"), "format", "oneof", "csv, ndjson")
+	v.Check(validator.PermittedValue(input.Filters.Sort, input.Filters.SortSafelist...), "sort", "oneof", strings.Join(input.Filters.SortSafelist, ", "))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var writer replayio.Writer
+	switch exportFormat(r, input.Format) {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="replays.csv"`)
+		writer = replayio.NewCSVWriter(w)
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="replays.ndjson"`)
+		writer = replayio.NewNDJSONWriter(w)
+	default:
+		app.notAcceptableResponse(w, r)
+		return
+	}
+
+	// The export can outlive the server WriteTimeout, so push the write deadline
+	// forward every time a chunk is flushed to the client.
+	rc := http.NewResponseController(w)
+	flush := func() error {
+		err := writer.Flush()
+		if err != nil {
+			return err
+		}
+		err = rc.Flush()
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		err = rc.SetWriteDeadline(time.Now().Add(app.config.export.writeTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+	w.WriteHeader(http.StatusOK)
+	err := flush()
+	if err != nil {
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	lastFlush := time.Now()
+	err = app.modelsFor(r).Replays.Export(r.Context(), input.Title, input.Heroes, input.Filters, func(replay *data.Replay) error {
+		replay.SetRuntimeFormat(input.RuntimeFormat)
+		err := writer.Write(replay)
+		if err != nil {
+			return err
+		}
+		if time.Since(lastFlush) >= exportFlushInterval {
+			lastFlush = time.Now()
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// The status line has already been sent, so all that can be done is to
+		// record the failure and cut the stream short. Returning would end
+		// the chunked body cleanly and make the export look complete.
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+}
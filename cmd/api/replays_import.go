@@ -0,0 +1,156 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/i18n"
+	"DotaReplays/internal/replayio"
+	"DotaReplays/internal/validator"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const maxImportBytes = 64 << 20
+
+// importTimeout is how long an import may take to upload and insert.
+const importTimeout = 5 * time.Minute
+
+type importRow struct {
+	Line   int                 `json:"line"`
+	Status string              `json:"status"`
+	ID     int64               `json:"id,omitempty"`
+	Errors map[string][]string `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	DryRun   bool        `json:"dry_run"`
+	Total    int         `json:"total"`
+	Imported int         `json:"imported"`
+	Failed   int         `json:"failed"`
+	Rows     []importRow `json:"rows"`
+}
+
+func (app *application) importReplaysHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	format := app.readString(qs, "format", "")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/jsonl", "application/jsonlines":
+			format = "ndjson"
+		}
+	}
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The import body can be far larger than a regular request, so give the
+	// client more time to upload it than the server-wide timeouts allow. The
+	// write deadline counts from the request headers too, so it has to move
+	// with the read deadline or the report would be dropped.
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(time.Now().Add(importTimeout))
+	if err == nil {
+		err = rc.SetWriteDeadline(time.Now().Add(importTimeout))
+	}
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var reader replayio.Reader
+	switch format {
+	case "csv":
+		reader = replayio.NewCSVReader(body)
+	case "ndjson":
+		reader = replayio.NewNDJSONReader(body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	var importer *data.ReplayImporter
+	if !dryRun {
+		importer, err = app.modelsFor(r).Replays.NewImporter()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		defer importer.Rollback()
+	}
+
+	report := importReport{DryRun: dryRun, Rows: []importRow{}}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesError):
+				app.badRequestResponse(w, r, i18n.Errorf("body_too_large", maxBytesError.Limit))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+		report.Total++
+		row := importRow{Line: record.Line}
+		if record.Err != nil {
+			row.Status = "invalid"
+			row.Errors = map[string][]string{"row": {app.translateError(r, record.Err)}}
+			report.Failed++
+			report.Rows = append(report.Rows, row)
+			continue
+		}
+		v := validator.New()
+		if data.ValidateReplay(v, record.Replay); !v.Valid() {
+			row.Status = "invalid"
+			row.Errors = app.translateValidationErrors(r, v.Errors)
+			report.Failed++
+			report.Rows = append(report.Rows, row)
+			continue
+		}
+		if dryRun {
+			row.Status = "valid"
+		} else {
+			err = importer.Insert(record.Replay)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			row.Status = "created"
+			row.ID = record.Replay.ID
+			report.Imported++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	if !dryRun {
+		err = importer.Commit()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	// Give the report the usual time to be written, however long the import
+	// itself took.
+	err = rc.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,18 +5,93 @@ import (
 	"net/http"
 )
 
+// showOrExportReplayHandler exists because httprouter does not allow the static
+// /v1/replays/export path to live next to the /v1/replays/:id wildcard. The
+// export negotiates its own media type, which ?format can override.
+func (app *application) showOrExportReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") == "export" {
+		app.exportReplaysHandler(w, r)
+		return
+	}
+	app.produces(objectMediaTypes, app.showReplayHandler)(w, r)
+}
+
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/replays", app.requirePermission("replays:read", app.listReplaysHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/replays", app.requirePermission("replays:write", app.createReplayHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/replays/:id", app.requirePermission("replays:read", app.showReplayHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/replays/:id", app.requirePermission("replays:write", app.updateReplayHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/replays/:id", app.requirePermission("replays:write", app.deleteReplayHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
-	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
+	route := func(method, path string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, path, app.routePattern(path, handler))
+	}
+	handle := func(method, path string, handler http.HandlerFunc) {
+		route(method, path, app.produces(objectMediaTypes, handler))
+	}
+	handleList := func(path string, handler http.HandlerFunc) {
+		route(http.MethodGet, path, app.produces(listMediaTypes, handler))
+	}
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	handle(http.MethodGet, "/v1/healthcheck/live", app.livenessHandler)
+	handle(http.MethodGet, "/v1/healthcheck/ready", app.readinessHandler)
+	handleList("/v1/replays", app.requirePermission("replays:read", app.listReplaysHandler))
+	handle(http.MethodPost, "/v1/replays", app.requirePermission("replays:write", app.createReplayHandler))
+	handle(http.MethodPost, "/v1/replays/import", app.requirePermission("replays:write", app.importReplaysHandler))
+	route(http.MethodGet, "/v1/replays/:id", app.requirePermission("replays:read", app.showOrExportReplayHandler))
+	handleList("/v1/replays/:id/similar", app.requirePermission("replays:read", app.listSimilarReplaysHandler))
+	handle(http.MethodPatch, "/v1/replays/:id", app.requirePermission("replays:write", app.updateReplayHandler))
+	handle(http.MethodDelete, "/v1/replays/:id", app.requirePermission("replays:write", app.deleteReplayHandler))
+	handle(http.MethodPost, "/v1/users", app.registerUserHandler)
+	handle(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(http.MethodPost, "/v1/users/activation/resend", app.resendActivationTokenHandler)
+	handle(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.requireUserRecord(app.showCurrentUserHandler)))
+	handle(http.MethodPatch, "/v1/users/me", app.requireAuthenticatedUser(app.requireUserRecord(app.updateCurrentUserHandler)))
+	handle(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.requireUserRecord(app.deleteCurrentUserHandler)))
+	handle(http.MethodPut, "/v1/users/me/password", app.requireAuthenticatedUser(app.requireUserRecord(app.changePasswordHandler)))
+	handle(http.MethodGet, "/v1/users/me/export", app.requireAuthenticatedUser(app.requireUserRecord(app.exportCurrentUserHandler)))
+	handle(http.MethodPatch, "/v1/users/me/email", app.requireActivatedUser(app.requireUserRecord(app.requestEmailChangeHandler)))
+	handle(http.MethodPut, "/v1/users/email/confirmed", app.confirmEmailChangeHandler)
+	handle(http.MethodPut, "/v1/users/email/cancelled", app.cancelEmailChangeHandler)
+	handle(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	if app.accessTokens != nil {
+		handle(http.MethodPost, "/v1/tokens/access", app.createAccessTokenHandler)
+		handle(http.MethodPost, "/v1/tokens/refresh", app.refreshAccessTokenHandler)
+		handle(http.MethodPost, "/v1/tokens/revoke", app.revokeRefreshTokenHandler)
+	}
+	handle(http.MethodGet, "/v1/auth/steam/start", app.startSteamLoginHandler)
+	handle(http.MethodGet, "/v1/auth/steam/callback", app.steamCallbackHandler)
+	handle(http.MethodGet, "/v1/auth/oidc/:provider/start", app.startOIDCLoginHandler)
+	handle(http.MethodGet, "/v1/auth/oidc/:provider/callback", app.oidcCallbackHandler)
+	handleList("/v1/admin/jobs", app.requirePermission("admin:jobs", app.listJobsHandler))
+	handle(http.MethodPost, "/v1/admin/jobs/:id/retry", app.requirePermission("admin:jobs", app.retryJobHandler))
+	if app.config.env == "development" {
+		handle(http.MethodGet, "/debug/emails/:template", app.previewEmailHandler)
+	}
+	// Middleware is listed innermost first; each one gets its own span.
+	handler := http.Handler(router)
+	for _, mw := range []struct {
+		name string
+		fn   func(http.Handler) http.Handler
+	}{
+		{"authenticate", app.authenticate},
+		{"rateLimit", app.rateLimit},
+		{"negotiateContent", app.negotiateContent},
+		{"recoverPanic", app.recoverPanic},
+		{"logRequests", app.logRequests},
+		{"requestID", app.requestID},
+	} {
+		handler = app.traceMiddleware(mw.name, mw.fn)(handler)
+	}
+	return app.traceRequests(handler)
+}
+
+// adminRoutes serves operational endpoints on the admin port, which should
+// only be reachable from inside the deployment.
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", app.metrics.registry.Handler())
+	mux.Handle("/log/level", app.logger.LevelHandler())
+	// The admin server outlives the API during shutdown, so probes pointed
+	// here see readiness flip while requests drain.
+	mux.HandleFunc("/healthcheck/live", app.livenessHandler)
+	mux.HandleFunc("/healthcheck/ready", app.readinessHandler)
+	return mux
 }
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"DotaReplays/internal/jsonlog"
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
@@ -19,6 +22,35 @@ func (app *application) serve() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	// The admin server listens before anything else starts, so that a port
+	// clash is reported as a startup error.
+	var adminSrv *http.Server
+	if app.config.admin.port != 0 {
+		adminSrv = &http.Server{
+			Addr:         net.JoinHostPort(app.config.admin.addr, strconv.Itoa(app.config.admin.port)),
+			Handler:      app.adminRoutes(),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+		ln, err := net.Listen("tcp", adminSrv.Addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			err := adminSrv.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{"addr": adminSrv.Addr})
+			}
+		}()
+		app.logger.PrintInfo("starting admin server", map[string]string{
+			"addr": adminSrv.Addr,
+		})
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	app.background(func() {
+		app.queue.Run(jobsCtx)
+	})
 	shutdownError := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -27,17 +59,38 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("caught signal", map[string]string{
 			"signal": s.String(),
 		})
+		// Fail readiness checks first, and keep serving for a while if asked,
+		// so that load balancers stop sending requests before the listener
+		// closes.
+		app.shuttingDown.Store(true)
+		if app.config.shutdownDelay > 0 {
+			app.logger.Info("draining before shutdown", jsonlog.Duration("delay", app.config.shutdownDelay))
+			time.Sleep(app.config.shutdownDelay)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		err := srv.Shutdown(ctx)
+		// Stop claiming new jobs; the ones already running are waited for below
+		// and anything still queued is picked up on the next start.
+		stopJobs()
 		if err != nil {
 			shutdownError <- err
 		}
+		// The admin server is shut down after the API, so that metrics can be
+		// scraped while requests drain.
+		if adminSrv != nil {
+			adminSrv.Shutdown(ctx)
+		}
 
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
 		app.wg.Wait()
+		// Spans of the requests and jobs that just finished may still be
+		// buffered.
+		if err := app.tracer.Flush(); err != nil {
+			app.logger.PrintError(err, nil)
+		}
 		shutdownError <- nil
 	}()
 	app.logger.PrintInfo("starting server", map[string]string{
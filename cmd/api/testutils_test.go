@@ -0,0 +1,211 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/jobs"
+	"DotaReplays/internal/jsonlog"
+	"DotaReplays/internal/mailer"
+	"DotaReplays/internal/migrate"
+	"DotaReplays/migrations"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// testDSNEnv names the database that the tests which need one run against.
+// The tests migrate it and empty its users and jobs tables, so it must not
+// hold anything worth keeping.
+const testDSNEnv = "DOTAREPLAYS_TEST_DB_DSN"
+
+// tokenRX matches the token an email asks the user to send back.
+var tokenRX = regexp.MustCompile(`"token": "([A-Z2-7]{26})"`)
+
+type testApplication struct {
+	*application
+	mail    *mailer.Memory
+	handler http.Handler
+}
+
+// newTestDB opens the database named by testDSNEnv, migrates it to the latest
+// version and empties it, or skips the test if testDSNEnv is not set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mr, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = mr.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("TRUNCATE users, jobs CASCADE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestApplication returns an application that captures emails in memory.
+// With a database the job queue runs, so queued emails are sent; without one,
+// only requests that fail before reaching the database can be tested.
+func newTestApplication(t *testing.T, db *sql.DB) *testApplication {
+	t.Helper()
+	var cfg config
+	cfg.env = "development"
+	cfg.baseURL = "http://localhost:4000"
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	renderer := &mailer.Renderer{Sender: "DotaReplays <no-reply@example.com>", Brand: "DotaReplays", BaseURL: cfg.baseURL}
+	mail := mailer.NewMemory(renderer)
+	models := data.NewModels(db)
+	app := &application{
+		config:  cfg,
+		logger:  logger,
+		models:  models,
+		metrics: newMetrics(db),
+		mailer:  mail,
+		emails:  renderer,
+		queue:   jobs.New(models.Jobs, logger, jobs.Config{PollInterval: 10 * time.Millisecond}),
+	}
+	app.registerJobs()
+	if db != nil {
+		ctx, stop := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			app.queue.Run(ctx)
+			close(done)
+		}()
+		t.Cleanup(func() {
+			stop()
+			<-done
+		})
+	}
+	return &testApplication{application: app, mail: mail, handler: app.routes()}
+}
+
+// do sends a request with body encoded as JSON, authenticated with token
+// unless it is empty, and returns the status and the decoded response.
+func (ta *testApplication) do(t *testing.T, method, path, token string, body any) (int, map[string]any) {
+	t.Helper()
+	js, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(method, path, bytes.NewReader(js))
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	ta.handler.ServeHTTP(w, r)
+	var res map[string]any
+	err = json.Unmarshal(w.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+	}
+	return w.Code, res
+}
+
+// insertUser creates a user with password directly in the database and
+// returns it with an authentication token.
+func (ta *testApplication) insertUser(t *testing.T, email, password string, activated bool) (*data.User, string) {
+	t.Helper()
+	user := &data.User{Name: "Test User", Email: email, Activated: activated, Locale: "en"}
+	err := user.Password.Set(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ta.models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ta.models.Permissions.AddForUser(user.ID, "replays:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, ta.newAuthenticationToken(t, user.ID)
+}
+
+// newAuthenticationToken signs the user in, returning the token.
+func (ta *testApplication) newAuthenticationToken(t *testing.T, userID int64) string {
+	t.Helper()
+	token, err := ta.models.Tokens.New(userID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.Plaintext
+}
+
+// waitForMail waits for the queue to send n emails in all and returns them.
+func (ta *testApplication) waitForMail(t *testing.T, n int) []mailer.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		messages := ta.mail.Messages()
+		if len(messages) >= n {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d emails, want %d", len(messages), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// outboxCount returns how many emails have been queued, whether or not they
+// have been sent yet.
+func (ta *testApplication) outboxCount(t *testing.T) int {
+	t.Helper()
+	var count int
+	err := ta.models.Users.DB.QueryRowContext(context.Background(), "SELECT count(*) FROM email_outbox").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// checkMessage checks that msg went to recipient from templateFile and
+// returns the token in it.
+func checkMessage(t *testing.T, msg mailer.Message, recipient, templateFile string) string {
+	t.Helper()
+	if msg.To != recipient {
+		t.Errorf("email went to %q, want %q", msg.To, recipient)
+	}
+	if msg.Template != templateFile {
+		t.Errorf("email used %q, want %q", msg.Template, templateFile)
+	}
+	m := tokenRX.FindStringSubmatch(msg.HTMLBody)
+	if m == nil {
+		t.Fatalf("no token in %s email:\n%s", templateFile, msg.HTMLBody)
+	}
+	return m[1]
+}
+
+// fieldErrors returns the codes of the validation errors in res by field.
+func fieldErrors(res map[string]any) map[string][]string {
+	codes := make(map[string][]string)
+	list, _ := res["errors"].([]any)
+	for _, item := range list {
+		e, _ := item.(map[string]any)
+		field, _ := e["field"].(string)
+		code, _ := e["code"].(string)
+		codes[field] = append(codes[field], code)
+	}
+	return codes
+}
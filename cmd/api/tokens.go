@@ -2,16 +2,65 @@ package main
 
 import (
 	"DotaReplays/internal/data"
+	"DotaReplays/internal/jwt"
 	"DotaReplays/internal/validator"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// accessClaims are the claims of a signed access token. They carry what
+// authenticate and requirePermission need, so that requests made with one are
+// served without looking the user up.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Activated   bool     `json:"act"`
+	Locale      string   `json:"loc,omitempty"`
+	Permissions []string `json:"perms"`
+}
+
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readCredentials(w, r)
+	if !ok {
+		return
+	}
+	token, err := app.modelsFor(r).Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAccessTokenHandler signs in with a password like
+// createAuthenticationTokenHandler, but returns a short-lived signed access
+// token and a refresh token to get the next one with.
+func (app *application) createAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readCredentials(w, r)
+	if !ok {
+		return
+	}
+	env, err := app.newTokenPair(r, user, "")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshAccessTokenHandler exchanges a refresh token for a new access token
+// and a new refresh token. The access token is built from the user's current
+// record, so permission changes take effect here.
+func (app *application) refreshAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Token string `json:"token"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -19,38 +68,156 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 	v := validator.New()
-	data.ValidateEmail(v, input.Email)
-	data.ValidatePasswordPlaintext(v, input.Password)
-	if !v.Valid() {
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	user, err := app.models.Users.GetByEmail(input.Email)
+	// This runs outside a transaction, so that the family deleted on reuse
+	// stays deleted.
+	token, err := app.modelsFor(r).Tokens.UseRefresh(input.Token)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			app.logger.PrintInfo("refresh token reused, signed out its family", map[string]string{
+				"request_id": app.contextGetRequestID(r),
+			})
+			v.AddError("token", "invalid_token")
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			v.AddError("token", "invalid_token")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	match, err := user.Password.Matches(input.Password)
+	user, err := app.modelsFor(r).Users.Get(token.UserID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	if !match {
-		app.invalidCredentialsResponse(w, r)
+	env, err := app.newTokenPair(r, user, token.Family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = app.writeResponse(w, r, http.StatusCreated, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeRefreshTokenHandler signs out by deleting the refresh token and every
+// other token of its family. Access tokens already issued stay valid until
+// they expire.
+func (app *application) revokeRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	token, err := app.modelsFor(r).Tokens.Get(data.ScopeRefresh, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid_token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.modelsFor(r).Tokens.DeleteFamily(token.Family)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "the refresh token has been revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newTokenPair signs an access token for user and stores a refresh token in
+// family, or in a new family if family is empty.
+func (app *application) newTokenPair(r *http.Request, user *data.User, family string) (envelope, error) {
+	permissions, err := app.modelsFor(r).Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiry := now.Add(app.config.accessTokens.ttl)
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   app.config.baseURL,
+			Subject:  strconv.FormatInt(user.ID, 10),
+			IssuedAt: now.Unix(),
+			Expiry:   expiry.Unix(),
+		},
+		Activated:   user.Activated,
+		Locale:      user.Locale,
+		Permissions: permissions,
+	}
+	signed, err := app.accessTokens.Sign(&claims)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := app.modelsFor(r).Tokens.NewRefresh(user.ID, app.config.accessTokens.refreshTTL, family)
+	if err != nil {
+		return nil, err
+	}
+	return envelope{
+		"access_token":  &data.Token{Plaintext: signed, Expiry: time.Unix(expiry.Unix(), 0)},
+		"refresh_token": refresh,
+	}, nil
+}
+
+// readCredentials reads an email and password from the request body and
+// returns the user they belong to. If they do not match a user it sends the
+// response and returns false.
+func (app *application) readCredentials(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+	user, err := app.modelsFor(r).Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return nil, false
 	}
+	return user, true
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/trace"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// newTracer returns the tracer selected by -trace-exporter, and the file it
+// writes to if that needs closing on shutdown. With the exporter set to none
+// the tracer is nil, which traces nothing.
+func newTracer(cfg config) (*trace.Tracer, io.Closer, error) {
+	var w io.Writer
+	var closer io.Closer
+	switch cfg.trace.exporter {
+	case "none":
+		return nil, nil, nil
+	case "stdout":
+		w = os.Stdout
+	case "file":
+		f, err := os.OpenFile(cfg.trace.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", cfg.trace.exporter)
+	}
+	return trace.New(trace.NewExporter(w, "dotareplays-api")), closer, nil
+}
+
+// modelsFor returns the models with their queries traced under the request's
+// current span.
+func (app *application) modelsFor(r *http.Request) data.Models {
+	return app.models.WithContext(r.Context())
+}
+
+// traceRequests starts the root span of each request, continuing the trace
+// named by an incoming traceparent header.
+func (app *application) traceRequests(next http.Handler) http.Handler {
+	if app.tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := trace.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = trace.ContextWithRemoteParent(ctx, sc)
+		}
+		// The span is renamed after the route once the router has matched one.
+		ctx, span := app.tracer.Start(ctx, r.Method, trace.KindServer)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttribute("http.response.status_code", status)
+		if status >= 500 {
+			span.RecordError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+	})
+}
+
+// traceMiddleware gives a middleware its own span. The span ends when the
+// middleware hands the request on, so it measures the middleware's own work
+// rather than everything after it.
+func (app *application) traceMiddleware(name string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	if app.tracer == nil {
+		return mw
+	}
+	return func(next http.Handler) http.Handler {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(trace.Leave(r.Context())))
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := trace.Start(r.Context(), name)
+			// Ends the span of a middleware that answered the request itself.
+			defer span.End()
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
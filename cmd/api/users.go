@@ -8,21 +8,30 @@ import (
 	"time"
 )
 
+// activationResendInterval is how long a user has to wait before another
+// activation email is sent to them.
+const activationResendInterval = 5 * time.Minute
+
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Locale   string `json:"locale"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	if input.Locale == "" {
+		input.Locale = app.locale(r)
+	}
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    input.Locale,
 	}
 	err = user.Password.Set(input.Password)
 	if err != nil {
@@ -34,38 +43,35 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Users.Insert(user)
+	err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+		err := tx.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+		err = tx.Permissions.AddForUser(user.ID, "replays:read")
+		if err != nil {
+			return err
+		}
+		token, err := tx.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+		return app.sendEmail(tx, user, "user_welcome.tmpl", map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		})
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email address already exists")
+			v.AddError("email", "duplicate_email")
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	err = app.models.Permissions.AddForUser(user.ID, "replays:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	app.background(func() {
-		data := map[string]any{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
-		}
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-	})
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -85,11 +91,11 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.modelsFor(r).Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
+			v.AddError("token", "invalid_activation_token")
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -97,7 +103,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	user.Activated = true
-	err = app.models.Users.Update(user)
+	err = app.modelsFor(r).Users.Update(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -107,12 +113,72 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resendActivationTokenHandler issues a fresh activation token. It responds
+// the same way whether or not the address belongs to an inactive account, so
+// that it cannot be used to find out which addresses are registered.
+func (app *application) resendActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	env := envelope{"message": "an email will be sent to you containing activation instructions"}
+	user, err := app.modelsFor(r).Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !user.Activated {
+		err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+			sent, err := tx.EmailOutbox.CountSince(user.ID, "token_activation.tmpl", time.Now().Add(-activationResendInterval))
+			if err != nil || sent > 0 {
+				return err
+			}
+			err = tx.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+			if err != nil {
+				return err
+			}
+			token, err := tx.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+			if err != nil {
+				return err
+			}
+			return app.sendEmail(tx, user, "token_activation.tmpl", map[string]any{
+				"activationToken": token.Plaintext,
+			})
+		})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
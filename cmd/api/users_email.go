@@ -0,0 +1,191 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/validator"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+// requestEmailChangeHandler starts an email change. Nothing changes until the
+// new address is confirmed with the token sent to it; the old address gets a
+// notice with a token that cancels the change, unless it is a placeholder
+// that nobody receives mail at. As elsewhere, a reauthentication token can
+// stand in for the password.
+func (app *application) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email                 string `json:"email"`
+		Password              string `json:"password"`
+		ReauthenticationToken string `json:"reauthentication_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	v.Check(input.Email != user.Email, "email", "email_unchanged")
+	if !app.confirmUser(w, r, v, user, "password", input.Password, input.ReauthenticationToken) {
+		return
+	}
+	_, err = app.modelsFor(r).Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "duplicate_email")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+		// Only the most recent request can be confirmed or cancelled.
+		for _, scope := range []string{data.ScopeEmailChange, data.ScopeEmailCancel} {
+			err := tx.Tokens.DeleteAllForUser(scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+		confirm, err := tx.Tokens.NewWithPayload(user.ID, emailChangeTTL, data.ScopeEmailChange, input.Email)
+		if err != nil {
+			return err
+		}
+		cancel, err := tx.Tokens.NewWithPayload(user.ID, emailChangeTTL, data.ScopeEmailCancel, input.Email)
+		if err != nil {
+			return err
+		}
+		recipient := *user
+		recipient.Email = input.Email
+		err = app.sendEmail(tx, &recipient, "email_change_confirm.tmpl", map[string]any{
+			"newEmail": input.Email,
+			"token":    confirm.Plaintext,
+		})
+		if err != nil || strings.HasSuffix(user.Email, ".invalid") {
+			return err
+		}
+		return app.sendEmail(tx, user, "email_change_notice.tmpl", map[string]any{
+			"newEmail":    input.Email,
+			"cancelToken": cancel.Plaintext,
+		})
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{"message": "a confirmation email has been sent to the new address"}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	token, err := app.modelsFor(r).Tokens.Get(data.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid_token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user, err := app.modelsFor(r).Users.Get(token.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	user.Email = token.Payload
+	err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+		for _, scope := range []string{data.ScopeEmailChange, data.ScopeEmailCancel} {
+			err := tx.Tokens.DeleteAllForUser(scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Users.Update(user)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			// Someone registered the address after the change was requested.
+			// The tokens are kept, as the change may go through once that
+			// account is gone.
+			v.AddError("email", "duplicate_email")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	token, err := app.modelsFor(r).Tokens.Get(data.ScopeEmailCancel, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid_token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+		for _, scope := range []string{data.ScopeEmailChange, data.ScopeEmailCancel} {
+			err := tx.Tokens.DeleteAllForUser(scope, token.UserID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "the email change has been cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestEmailChange(t *testing.T) {
+	ta := newTestApplication(t, newTestDB(t))
+	_, auth := ta.insertUser(t, "dave@example.com", "pa55word1234", true)
+
+	status, res := ta.do(t, http.MethodPatch, "/v1/users/me/email", auth, map[string]string{
+		"email":    "dave@example.org",
+		"password": "wrong-password",
+	})
+	if status != http.StatusUnprocessableEntity || fieldErrors(res)["password"] == nil {
+		t.Fatalf("wrong password: got %d %v, want %d with a password error", status, res, http.StatusUnprocessableEntity)
+	}
+	if n := ta.outboxCount(t); n != 0 {
+		t.Fatalf("got %d emails queued, want 0", n)
+	}
+
+	status, _ = ta.do(t, http.MethodPatch, "/v1/users/me/email", auth, map[string]string{
+		"email":    "dave@example.org",
+		"password": "pa55word1234",
+	})
+	if status != http.StatusAccepted {
+		t.Fatalf("request: got %d, want %d", status, http.StatusAccepted)
+	}
+	ta.waitForMail(t, 2)
+	toNew := ta.mail.SentTo("dave@example.org")
+	toOld := ta.mail.SentTo("dave@example.com")
+	if len(toNew) != 1 || len(toOld) != 1 {
+		t.Fatalf("got %d emails to the new address and %d to the old, want 1 each", len(toNew), len(toOld))
+	}
+	confirm := checkMessage(t, toNew[0], "dave@example.org", "email_change_confirm.tmpl")
+	cancel := checkMessage(t, toOld[0], "dave@example.com", "email_change_notice.tmpl")
+	if confirm == cancel {
+		t.Error("the confirm and cancel tokens are the same")
+	}
+
+	status, res = ta.do(t, http.MethodPut, "/v1/users/email/confirmed", "", map[string]string{"token": confirm})
+	if status != http.StatusOK {
+		t.Fatalf("confirm: got %d, want %d", status, http.StatusOK)
+	}
+	user, _ := res["user"].(map[string]any)
+	if user["email"] != "dave@example.org" {
+		t.Errorf("confirm: email is %v, want dave@example.org", user["email"])
+	}
+
+	// The cancel token went with the change it could have undone.
+	status, _ = ta.do(t, http.MethodPut, "/v1/users/email/cancelled", "", map[string]string{"token": cancel})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("cancel after confirm: got %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+// TestEmailChangeWithReauthentication covers an account created through a
+// provider that gave no address, whose user never knew the password.
+func TestEmailChangeWithReauthentication(t *testing.T) {
+	ta := newTestApplication(t, newTestDB(t))
+	user, auth := ta.insertUser(t, "steam-76561197960287930@users.invalid", "pa55word1234", true)
+	reauth, err := ta.models.Tokens.New(user.ID, reauthenticationTTL, data.ScopeReauthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, res := ta.do(t, http.MethodPatch, "/v1/users/me/email", auth, map[string]string{"email": "ivan@example.com"})
+	if status != http.StatusUnprocessableEntity || fieldErrors(res)["password"] == nil {
+		t.Fatalf("no confirmation: got %d %v, want %d with a password error", status, res, http.StatusUnprocessableEntity)
+	}
+
+	status, _ = ta.do(t, http.MethodPatch, "/v1/users/me/email", auth, map[string]string{
+		"email":                  "ivan@example.com",
+		"reauthentication_token": reauth.Plaintext,
+	})
+	if status != http.StatusAccepted {
+		t.Fatalf("request: got %d, want %d", status, http.StatusAccepted)
+	}
+	messages := ta.waitForMail(t, 1)
+	confirm := checkMessage(t, messages[0], "ivan@example.com", "email_change_confirm.tmpl")
+	// Nobody receives mail at the placeholder, so it gets no notice.
+	if n := ta.outboxCount(t); n != 1 {
+		t.Errorf("got %d emails queued, want 1", n)
+	}
+
+	status, _ = ta.do(t, http.MethodPut, "/v1/users/email/confirmed", "", map[string]string{"token": confirm})
+	if status != http.StatusOK {
+		t.Errorf("confirm: got %d, want %d", status, http.StatusOK)
+	}
+}
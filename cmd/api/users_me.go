@@ -0,0 +1,251 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCurrentUserHandler changes the user's profile. The Steam ID is shown
+// but cannot be set here: it is only ever taken from a verified Steam sign-in.
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Name      *string `json:"name"`
+		Locale    *string `json:"locale"`
+		AvatarURL *string `json:"avatar_url"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Locale != nil {
+		user.Locale = *input.Locale
+	}
+	if input.AvatarURL != nil {
+		user.AvatarURL = *input.AvatarURL
+	}
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.modelsFor(r).Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// changePasswordHandler sets a new password and signs the user out everywhere
+// else by deleting their authentication and refresh tokens. Signed access
+// tokens cannot be revoked and stay valid until they expire.
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		CurrentPassword       string `json:"current_password"`
+		ReauthenticationToken string `json:"reauthentication_token"`
+		NewPassword           string `json:"new_password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidatePasswordPlaintextField(v, "new_password", input.NewPassword)
+	if !app.confirmUser(w, r, v, user, "current_password", input.CurrentPassword, input.ReauthenticationToken) {
+		return
+	}
+	err = user.Password.Set(input.NewPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.modelsFor(r).WithTx(func(tx data.Models) error {
+		err := tx.Users.Update(user)
+		if err != nil {
+			return err
+		}
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+			err := tx.Tokens.DeleteAllForUser(scope, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "your password has been changed, please sign in again"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportCurrentUserHandler returns everything stored about the user as a
+// single JSON document. Secrets such as the password hash, token hashes and
+// the tokens inside sent emails are left out.
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	permissions, err := app.modelsFor(r).Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	tokens, err := app.modelsFor(r).Tokens.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	emails, err := app.modelsFor(r).EmailOutbox.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	identities, err := app.modelsFor(r).Identities.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	type exportedToken struct {
+		Scope  string    `json:"scope"`
+		Expiry time.Time `json:"expiry"`
+	}
+	exportedTokens := make([]exportedToken, 0, len(tokens))
+	for _, token := range tokens {
+		exportedTokens = append(exportedTokens, exportedToken{Scope: token.Scope, Expiry: token.Expiry})
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.json"`, user.ID))
+	err = app.writeResponse(w, r, http.StatusOK, envelope{
+		"exported_at": time.Now().UTC(),
+		"user":        user,
+		"permissions": permissions,
+		"tokens":      exportedTokens,
+		"emails":      emails,
+		"identities":  identities,
+	}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCurrentUserHandler removes the account. Tokens, permissions, queued
+// emails and linked identities go with it through ON DELETE CASCADE.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		Password              string `json:"password"`
+		ReauthenticationToken string `json:"reauthentication_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if !app.confirmUser(w, r, v, user, "password", input.Password, input.ReauthenticationToken) {
+		return
+	}
+	err = app.modelsFor(r).Users.Delete(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "your account has been deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmUser checks that whoever makes a sensitive change is the user: by
+// their current password or, for accounts created through a provider, by a
+// reauthentication token from signing in with it again, which is used up.
+// If neither checks out, or v already holds errors, it sends the response
+// and returns false.
+func (app *application) confirmUser(w http.ResponseWriter, r *http.Request, v *validator.Validator, user *data.User, passwordKey, password, reauthenticationToken string) bool {
+	if reauthenticationToken == "" {
+		v.Check(password != "", passwordKey, "required")
+		return app.checkPassword(w, r, v, user, passwordKey, password)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	token, err := app.modelsFor(r).Tokens.Get(data.ScopeReauthentication, reauthenticationToken)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if err != nil || token.UserID != user.ID {
+		v.AddError("reauthentication_token", "invalid_token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeReauthentication, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	return true
+}
+
+// checkPassword confirms that password is the user's current password. If it
+// is not, or v already holds errors, it sends the response and returns false.
+func (app *application) checkPassword(w http.ResponseWriter, r *http.Request, v *validator.Validator, user *data.User, key, password string) bool {
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !match {
+		v.AddError(key, "incorrect_password")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	return true
+}
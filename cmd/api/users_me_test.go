@@ -0,0 +1,111 @@
+package main
+
+import (
+	"DotaReplays/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateCurrentUser(t *testing.T) {
+	ta := newTestApplication(t, newTestDB(t))
+	_, auth := ta.insertUser(t, "frank@example.com", "pa55word1234", true)
+
+	status, res := ta.do(t, http.MethodPatch, "/v1/users/me", auth, map[string]string{"name": "Frank", "locale": "ru"})
+	if status != http.StatusOK {
+		t.Fatalf("update: got %d, want %d", status, http.StatusOK)
+	}
+	user, _ := res["user"].(map[string]any)
+	if user["name"] != "Frank" || user["locale"] != "ru" {
+		t.Errorf("update: user is %v, want name Frank and locale ru", user)
+	}
+
+	// A Steam ID cannot be claimed without proof.
+	status, _ = ta.do(t, http.MethodPatch, "/v1/users/me", auth, map[string]string{"steam_id": "76561197960287930"})
+	if status != http.StatusBadRequest {
+		t.Errorf("steam_id: got %d, want %d", status, http.StatusBadRequest)
+	}
+	_, res = ta.do(t, http.MethodGet, "/v1/users/me", auth, nil)
+	if user, _ := res["user"].(map[string]any); user["steam_id"] != nil {
+		t.Errorf("steam_id was set to %v", user["steam_id"])
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ta := newTestApplication(t, newTestDB(t))
+	_, auth := ta.insertUser(t, "erin@example.com", "pa55word1234", true)
+
+	status, res := ta.do(t, http.MethodPut, "/v1/users/me/password", auth, map[string]string{
+		"current_password": "wrong-password",
+		"new_password":     "n3w-pa55word",
+	})
+	if status != http.StatusUnprocessableEntity || fieldErrors(res)["current_password"] == nil {
+		t.Fatalf("wrong password: got %d %v, want %d with a current_password error", status, res, http.StatusUnprocessableEntity)
+	}
+
+	status, _ = ta.do(t, http.MethodPut, "/v1/users/me/password", auth, map[string]string{
+		"current_password": "pa55word1234",
+		"new_password":     "n3w-pa55word",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("change: got %d, want %d", status, http.StatusOK)
+	}
+	if n := ta.outboxCount(t); n != 0 {
+		t.Errorf("got %d emails queued, want 0", n)
+	}
+	status, _ = ta.do(t, http.MethodGet, "/v1/users/me", auth, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("old token: got %d, want %d", status, http.StatusUnauthorized)
+	}
+	status, _ = ta.do(t, http.MethodPost, "/v1/tokens/authentication", "", map[string]string{
+		"email":    "erin@example.com",
+		"password": "n3w-pa55word",
+	})
+	if status != http.StatusCreated {
+		t.Errorf("sign in with the new password: got %d, want %d", status, http.StatusCreated)
+	}
+}
+
+// TestConfirmWithReauthentication covers accounts created through a provider,
+// whose users confirm sensitive changes by signing in with it again rather
+// than with a password they never knew.
+func TestConfirmWithReauthentication(t *testing.T) {
+	ta := newTestApplication(t, newTestDB(t))
+	user, auth := ta.insertUser(t, "grace@example.com", "pa55word1234", true)
+	other, _ := ta.insertUser(t, "heidi@example.com", "pa55word1234", true)
+	newReauth := func(userID int64) string {
+		t.Helper()
+		token, err := ta.models.Tokens.New(userID, reauthenticationTTL, data.ScopeReauthentication)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.Plaintext
+	}
+
+	status, res := ta.do(t, http.MethodPut, "/v1/users/me/password", auth, map[string]string{
+		"reauthentication_token": newReauth(other.ID),
+		"new_password":           "n3w-pa55word",
+	})
+	if status != http.StatusUnprocessableEntity || fieldErrors(res)["reauthentication_token"] == nil {
+		t.Fatalf("someone else's token: got %d %v, want %d with a reauthentication_token error", status, res, http.StatusUnprocessableEntity)
+	}
+
+	reauth := newReauth(user.ID)
+	status, _ = ta.do(t, http.MethodPut, "/v1/users/me/password", auth, map[string]string{
+		"reauthentication_token": reauth,
+		"new_password":           "n3w-pa55word",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("change: got %d, want %d", status, http.StatusOK)
+	}
+
+	// The token is used up, and the change signed the user out.
+	auth = ta.newAuthenticationToken(t, user.ID)
+	status, _ = ta.do(t, http.MethodDelete, "/v1/users/me", auth, map[string]string{"reauthentication_token": reauth})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("reused token: got %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+	status, _ = ta.do(t, http.MethodDelete, "/v1/users/me", auth, map[string]string{"reauthentication_token": newReauth(user.ID)})
+	if status != http.StatusOK {
+		t.Fatalf("delete: got %d, want %d", status, http.StatusOK)
+	}
+}
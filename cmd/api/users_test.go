@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRegisterUserInvalid(t *testing.T) {
+	ta := newTestApplication(t, nil)
+	status, res := ta.do(t, http.MethodPost, "/v1/users", "", map[string]string{
+		"name":     "Alice",
+		"email":    "not-an-address",
+		"password": "short",
+	})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+	errs := fieldErrors(res)
+	if errs["email"] == nil || errs["password"] == nil {
+		t.Errorf("got errors %v, want email and password errors", errs)
+	}
+	if n := len(ta.mail.Messages()); n != 0 {
+		t.Errorf("sent %d emails, want 0", n)
+	}
+}
+
+func TestRegisterUser(t *testing.T) {
+	ta := newTestApplication(t, newTestDB(t))
+	status, _ := ta.do(t, http.MethodPost, "/v1/users", "", map[string]string{
+		"name":     "Alice",
+		"email":    "alice@example.com",
+		"password": "pa55word1234",
+	})
+	if status != http.StatusAccepted {
+		t.Fatalf("register: got %d, want %d", status, http.StatusAccepted)
+	}
+	messages := ta.waitForMail(t, 1)
+	token := checkMessage(t, messages[0], "alice@example.com", "user_welcome.tmpl")
+
+	status, res := ta.do(t, http.MethodPut, "/v1/users/activated", "", map[string]string{"token": token})
+	if status != http.StatusOK {
+		t.Fatalf("activate: got %d, want %d", status, http.StatusOK)
+	}
+	user, _ := res["user"].(map[string]any)
+	if user["activated"] != true {
+		t.Errorf("activate: user is %v, want activated", user)
+	}
+}
+
+func TestResendActivationToken(t *testing.T) {
+	ta := newTestApplication(t, newTestDB(t))
+	ta.insertUser(t, "bob@example.com", "pa55word1234", false)
+	ta.insertUser(t, "carol@example.com", "pa55word1234", true)
+
+	// Unknown and activated addresses get the same response, and no email.
+	for _, email := range []string{"nobody@example.com", "carol@example.com"} {
+		status, _ := ta.do(t, http.MethodPost, "/v1/users/activation/resend", "", map[string]string{"email": email})
+		if status != http.StatusAccepted {
+			t.Errorf("resend to %s: got %d, want %d", email, status, http.StatusAccepted)
+		}
+	}
+	if n := ta.outboxCount(t); n != 0 {
+		t.Fatalf("got %d emails queued, want 0", n)
+	}
+
+	status, _ := ta.do(t, http.MethodPost, "/v1/users/activation/resend", "", map[string]string{"email": "bob@example.com"})
+	if status != http.StatusAccepted {
+		t.Fatalf("resend: got %d, want %d", status, http.StatusAccepted)
+	}
+	messages := ta.waitForMail(t, 1)
+	token := checkMessage(t, messages[0], "bob@example.com", "token_activation.tmpl")
+
+	// A second request within the resend interval sends nothing more.
+	ta.do(t, http.MethodPost, "/v1/users/activation/resend", "", map[string]string{"email": "bob@example.com"})
+	if n := ta.outboxCount(t); n != 1 {
+		t.Errorf("got %d emails queued, want 1", n)
+	}
+
+	status, _ = ta.do(t, http.MethodPut, "/v1/users/activated", "", map[string]string{"token": token})
+	if status != http.StatusOK {
+		t.Errorf("activate: got %d, want %d", status, http.StatusOK)
+	}
+}
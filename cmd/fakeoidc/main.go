@@ -0,0 +1,391 @@
+// Command fakeoidc is a mock OpenID Connect issuer for local development and
+// testing of the /v1/auth/oidc flow. Run it and list it in the API's
+// -oidc-config file:
+//
+//	{"providers": [{
+//	    "name": "dev",
+//	    "issuer": "http://localhost:4200",
+//	    "client_id": "dotareplays",
+//	    "client_secret": "secret",
+//	    "scopes": ["openid", "email", "profile", "groups"],
+//	    "roles_claim": "groups",
+//	    "roles": {"editors": ["replays:read", "replays:write"]},
+//	    "default_permissions": ["replays:read"]
+//	}]}
+//
+// It supports the authorization code flow with S256 PKCE only. The authorize
+// endpoint shows a form to choose the claims of the signed-in user, or issues
+// a code for the -sub user straight away with -auto. ID tokens are signed with
+// an RSA key generated at startup.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const codeTTL = time.Minute
+
+var approveForm = template.Must(template.New("approve").Parse(`<!doctype html>
+<html>
+<head><title>Mock OIDC sign-in</title></head>
+<body>
+<h1>Mock OIDC sign-in</h1>
+<form method="post" action="authorize/approve">
+<input type="hidden" name="request" value="{{.Request}}" />
+<p><label>Subject <input name="sub" value="{{.Sub}}" required /></label></p>
+<p><label>Name <input name="name" value="{{.Name}}" /></label></p>
+<p><label>Email <input name="email" value="{{.Email}}" /></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked /> Email verified</label></p>
+<p><label>Groups <input name="groups" value="{{.Groups}}" /> (comma separated)</label></p>
+<button type="submit">Sign in</button>
+<button type="submit" name="cancel" value="1">Cancel</button>
+</form>
+</body>
+</html>
+`))
+
+type user struct {
+	sub           string
+	name          string
+	email         string
+	emailVerified bool
+	groups        []string
+}
+
+// grant is an issued authorization code and what it was issued for.
+type grant struct {
+	user        user
+	redirectURI string
+	nonce       string
+	challenge   string
+	expiry      time.Time
+}
+
+type issuer struct {
+	url          string
+	clientID     string
+	clientSecret string
+	auto         bool
+	user         user
+	key          *rsa.PrivateKey
+	kid          string
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func main() {
+	var iss issuer
+	var addr, groups string
+	flag.StringVar(&addr, "addr", ":4200", "Listen address")
+	flag.StringVar(&iss.url, "issuer", "http://localhost:4200", "Issuer identifier, the public base URL of this server")
+	flag.StringVar(&iss.clientID, "client-id", "dotareplays", "Client ID accepted by the issuer")
+	flag.StringVar(&iss.clientSecret, "client-secret", "secret", "Client secret accepted by the issuer, empty for a public client")
+	flag.BoolVar(&iss.auto, "auto", false, "Sign every request in as the default user without showing a form")
+	flag.StringVar(&iss.user.sub, "sub", "alice", "Subject of the default user")
+	flag.StringVar(&iss.user.name, "name", "Alice", "Name of the default user")
+	flag.StringVar(&iss.user.email, "email", "alice@example.com", "Email address of the default user")
+	flag.StringVar(&groups, "groups", "editors", "Comma separated groups of the default user")
+	flag.Parse()
+	iss.url = strings.TrimRight(iss.url, "/")
+	iss.user.emailVerified = true
+	iss.user.groups = splitList(groups)
+	var err error
+	iss.key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	iss.kid = randomString(8)
+	iss.grants = make(map[string]grant)
+
+	log.Printf("mock OIDC issuer %s", iss.url)
+	log.Fatal(http.ListenAndServe(addr, iss.routes()))
+}
+
+func (iss *issuer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("/jwks", iss.jwks)
+	mux.HandleFunc("/authorize", iss.authorize)
+	mux.HandleFunc("/authorize/approve", iss.approve)
+	mux.HandleFunc("/token", iss.token)
+	return mux
+}
+
+func (iss *issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                iss.url,
+		"authorization_endpoint":                iss.url + "/authorize",
+		"token_endpoint":                        iss.url + "/token",
+		"jwks_uri":                              iss.url + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+func (iss *issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := iss.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": iss.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize checks an authorization request. Errors about the client or the
+// redirect URI are shown here, as the spec forbids redirecting them.
+func (iss *issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("client_id") != iss.clientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(redirectURI); err != nil || !u.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case q.Get("response_type") != "code":
+		redirectError(w, r, redirectURI, q.Get("state"), "unsupported_response_type")
+		return
+	case !containsString(strings.Fields(q.Get("scope")), "openid"):
+		redirectError(w, r, redirectURI, q.Get("state"), "invalid_scope")
+		return
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		redirectError(w, r, redirectURI, q.Get("state"), "invalid_request")
+		return
+	}
+	if iss.auto {
+		iss.issueCode(w, r, q, iss.user)
+		return
+	}
+	approveForm.Execute(w, map[string]string{
+		"Request": r.URL.RawQuery,
+		"Sub":     iss.user.sub,
+		"Name":    iss.user.name,
+		"Email":   iss.user.email,
+		"Groups":  strings.Join(iss.user.groups, ","),
+	})
+}
+
+func (iss *issuer) approve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// The form carries the original request, which was checked by authorize
+	// and is checked again here, as it came back through the browser.
+	q, err := url.ParseQuery(r.PostFormValue("request"))
+	if err != nil || q.Get("client_id") != iss.clientID || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if r.PostFormValue("cancel") != "" {
+		redirectError(w, r, q.Get("redirect_uri"), q.Get("state"), "access_denied")
+		return
+	}
+	u := user{
+		sub:           r.PostFormValue("sub"),
+		name:          r.PostFormValue("name"),
+		email:         r.PostFormValue("email"),
+		emailVerified: r.PostFormValue("email_verified") == "true",
+		groups:        splitList(r.PostFormValue("groups")),
+	}
+	if u.sub == "" {
+		http.Error(w, "subject is required", http.StatusBadRequest)
+		return
+	}
+	iss.issueCode(w, r, q, u)
+}
+
+func (iss *issuer) issueCode(w http.ResponseWriter, r *http.Request, q url.Values, u user) {
+	code := randomString(16)
+	iss.mu.Lock()
+	for c, g := range iss.grants {
+		if time.Now().After(g.expiry) {
+			delete(iss.grants, c)
+		}
+	}
+	iss.grants[code] = grant{
+		user:        u,
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expiry:      time.Now().Add(codeTTL),
+	}
+	iss.mu.Unlock()
+	params := url.Values{"code": {code}}
+	if state := q.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	http.Redirect(w, r, withQuery(q.Get("redirect_uri"), params), http.StatusFound)
+}
+
+// token redeems a code. Each code works once, and only with the redirect URI
+// and PKCE verifier it was issued for.
+func (iss *issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if !iss.authenticateClient(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	iss.mu.Lock()
+	g, ok := iss.grants[r.PostForm.Get("code")]
+	delete(iss.grants, r.PostForm.Get("code"))
+	iss.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(g.expiry):
+	case g.redirectURI != r.PostForm.Get("redirect_uri"):
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+	default:
+		idToken, err := iss.sign(g)
+		if err != nil {
+			tokenError(w, http.StatusInternalServerError, "server_error")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": randomString(16),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+		return
+	}
+	tokenError(w, http.StatusBadRequest, "invalid_grant")
+}
+
+func (iss *issuer) authenticateClient(r *http.Request) bool {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	return id == iss.clientID && subtle.ConstantTimeCompare([]byte(secret), []byte(iss.clientSecret)) == 1
+}
+
+func (iss *issuer) sign(g grant) (string, error) {
+	now := time.Now()
+	claims := map[string]any{
+		"iss":            iss.url,
+		"sub":            g.user.sub,
+		"aud":            iss.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"name":           g.user.name,
+		"email":          g.user.email,
+		"email_verified": g.user.emailVerified,
+		"groups":         g.user.groups,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": iss.kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code string) {
+	params := url.Values{"error": {code}}
+	if state != "" {
+		params.Set("state", state)
+	}
+	http.Redirect(w, r, withQuery(redirectURI, params), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func withQuery(rawURL string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + q.Encode()
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"DotaReplays/internal/oidc"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testRedirectURL = "http://localhost:4000/v1/auth/oidc/dev/callback"
+
+// newTestIssuer starts the mock issuer and returns it with a provider
+// configured for it, as the API would be.
+func newTestIssuer(t *testing.T, auto bool) (*issuer, *httptest.Server, *oidc.Provider) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &issuer{
+		clientID:     "dotareplays",
+		clientSecret: "secret",
+		auto:         auto,
+		user:         user{sub: "alice", name: "Alice", email: "alice@example.com", emailVerified: true, groups: []string{"editors"}},
+		key:          key,
+		kid:          randomString(8),
+		grants:       make(map[string]grant),
+	}
+	srv := httptest.NewServer(iss.routes())
+	t.Cleanup(srv.Close)
+	iss.url = srv.URL
+	p := oidc.New(oidc.Config{
+		Issuer:       srv.URL,
+		ClientID:     "dotareplays",
+		ClientSecret: "secret",
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email", "profile", "groups"},
+	})
+	p.Client = srv.Client()
+	return iss, srv, p
+}
+
+// callback returns the query of the redirect to the API's callback in res.
+func callback(t *testing.T, res *http.Response) url.Values {
+	t.Helper()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("got %s, want a redirect", res.Status)
+	}
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(loc.String(), testRedirectURL+"?") {
+		t.Fatalf("redirected to %s", loc)
+	}
+	return loc.Query()
+}
+
+func noRedirects(srv *httptest.Server) *http.Client {
+	c := srv.Client()
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return c
+}
+
+// authorize starts a sign-in for the default user and returns the code.
+func authorize(t *testing.T, srv *httptest.Server, p *oidc.Provider, state, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := noRedirects(srv).Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := callback(t, res)
+	if q.Get("state") != state {
+		t.Errorf("got state %q, want %q", q.Get("state"), state)
+	}
+	return q.Get("code")
+}
+
+func TestFlow(t *testing.T) {
+	_, srv, p := newTestIssuer(t, true)
+	ctx := context.Background()
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	code := authorize(t, srv, p, "af0ifjsldkj", "n-0S6_WzA2Mj", verifier)
+	claims, err := p.Exchange(ctx, code, verifier, "n-0S6_WzA2Mj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject() != "alice" || claims.String("email") != "alice@example.com" || !claims.Bool("email_verified") {
+		t.Errorf("got claims %v", claims)
+	}
+	if groups := claims.Strings("groups"); len(groups) != 1 || groups[0] != "editors" {
+		t.Errorf("got groups %v, want [editors]", groups)
+	}
+
+	// Codes work once.
+	_, err = p.Exchange(ctx, code, verifier, "n-0S6_WzA2Mj")
+	if !errors.Is(err, oidc.ErrInvalidResponse) {
+		t.Errorf("reused code: got %v, want %v", err, oidc.ErrInvalidResponse)
+	}
+
+	code = authorize(t, srv, p, "state", "nonce", verifier)
+	_, err = p.Exchange(ctx, code, verifier+"x", "nonce")
+	if !errors.Is(err, oidc.ErrInvalidResponse) {
+		t.Errorf("wrong verifier: got %v, want %v", err, oidc.ErrInvalidResponse)
+	}
+
+	// An ID token issued for another sign-in is refused.
+	code = authorize(t, srv, p, "state", "nonce", verifier)
+	_, err = p.Exchange(ctx, code, verifier, "other-nonce")
+	if !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Errorf("wrong nonce: got %v, want %v", err, oidc.ErrInvalidToken)
+	}
+}
+
+func TestFlowWrongClient(t *testing.T) {
+	_, srv, p := newTestIssuer(t, true)
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	code := authorize(t, srv, p, "state", "nonce", verifier)
+
+	p.ClientSecret = "wrong"
+	_, err := p.Exchange(context.Background(), code, verifier, "nonce")
+	if !errors.Is(err, oidc.ErrInvalidResponse) {
+		t.Errorf("wrong secret: got %v, want %v", err, oidc.ErrInvalidResponse)
+	}
+}
+
+func TestFlowApproveForm(t *testing.T) {
+	_, srv, p := newTestIssuer(t, false)
+	ctx := context.Background()
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	authURL, err := p.AuthURL(ctx, "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := noRedirects(srv)
+
+	res, err := client.PostForm(srv.URL+"/authorize/approve", url.Values{
+		"request": {u.RawQuery},
+		"sub":     {"bob"},
+		"email":   {"bob@example.com"},
+		"groups":  {"viewers, editors"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Exchange(ctx, callback(t, res).Get("code"), verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject() != "bob" || claims.Bool("email_verified") {
+		t.Errorf("got claims %v, want bob with an unverified email", claims)
+	}
+	if groups := claims.Strings("groups"); len(groups) != 2 {
+		t.Errorf("got groups %v, want 2", groups)
+	}
+
+	res, err = client.PostForm(srv.URL+"/authorize/approve", url.Values{
+		"request": {u.RawQuery},
+		"cancel":  {"1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := callback(t, res); q.Get("error") != "access_denied" || q.Get("code") != "" {
+		t.Errorf("cancel: got %v, want access_denied", q)
+	}
+}
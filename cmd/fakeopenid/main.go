@@ -0,0 +1,205 @@
+// Command fakeopenid is a stand-in for the Steam OpenID 2.0 provider, for
+// local development and testing of the /v1/auth/steam flow. Run it and start
+// the API with -steam-openid-endpoint=http://localhost:4100/openid/login.
+//
+// It implements just enough of OpenID 2.0 for that flow: checkid_setup shows
+// a form to pick the Steam ID to sign in as (or approves straight away with
+// -auto), and check_authentication verifies the signature and nonce of an
+// assertion it issued.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const namespace = "http://specs.openid.net/auth/2.0"
+
+var (
+	steamIDRX = regexp.MustCompile(`^7656119\d{10}$`)
+	signed    = []string{"op_endpoint", "claimed_id", "identity", "return_to", "response_nonce", "assoc_handle"}
+)
+
+var approveForm = template.Must(template.New("approve").Parse(`<!doctype html>
+<html>
+<head><title>Fake Steam sign-in</title></head>
+<body>
+<h1>Fake Steam sign-in</h1>
+<p>{{.Realm}} wants to know your Steam ID.</p>
+<form method="post" action="approve">
+<input type="hidden" name="return_to" value="{{.ReturnTo}}" />
+<label>Steam ID <input name="steamid" value="{{.SteamID}}" pattern="7656119[0-9]{10}" required /></label>
+<button type="submit">Sign in</button>
+<button type="submit" name="cancel" value="1">Cancel</button>
+</form>
+</body>
+</html>
+`))
+
+type provider struct {
+	baseURL string
+	steamID string
+	auto    bool
+	secret  []byte
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func main() {
+	var p provider
+	var addr string
+	flag.StringVar(&addr, "addr", ":4100", "Listen address")
+	flag.StringVar(&p.baseURL, "base-url", "http://localhost:4100", "Public base URL of this provider")
+	flag.StringVar(&p.steamID, "steam-id", "76561197960287930", "Steam ID offered by default")
+	flag.BoolVar(&p.auto, "auto", false, "Approve every request with -steam-id without showing a form")
+	flag.Parse()
+	p.baseURL = strings.TrimRight(p.baseURL, "/")
+	p.secret = make([]byte, 32)
+	if _, err := rand.Read(p.secret); err != nil {
+		log.Fatal(err)
+	}
+	p.nonces = make(map[string]time.Time)
+
+	log.Printf("fake Steam OpenID provider at %s", p.endpoint())
+	log.Fatal(http.ListenAndServe(addr, p.routes()))
+}
+
+func (p *provider) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openid/login", p.login)
+	mux.HandleFunc("/openid/approve", p.approve)
+	return mux
+}
+
+func (p *provider) endpoint() string {
+	return p.baseURL + "/openid/login"
+}
+
+func (p *provider) login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Form.Get("openid.mode") {
+	case "checkid_setup":
+		returnTo := r.Form.Get("openid.return_to")
+		realm := r.Form.Get("openid.realm")
+		if r.Form.Get("openid.ns") != namespace || returnTo == "" || !strings.HasPrefix(returnTo, realm) {
+			http.Error(w, "invalid checkid_setup request", http.StatusBadRequest)
+			return
+		}
+		if p.auto {
+			p.redirect(w, r, returnTo, p.steamID)
+			return
+		}
+		approveForm.Execute(w, map[string]string{"Realm": realm, "ReturnTo": returnTo, "SteamID": p.steamID})
+	case "check_authentication":
+		if r.Method != http.MethodPost {
+			http.Error(w, "check_authentication must be a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		valid := p.verify(r.Form)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "ns:%s\nis_valid:%t\n", namespace, valid)
+	default:
+		http.Error(w, "unsupported openid.mode", http.StatusBadRequest)
+	}
+}
+
+func (p *provider) approve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	returnTo := r.PostFormValue("return_to")
+	if r.PostFormValue("cancel") != "" {
+		q := url.Values{"openid.ns": {namespace}, "openid.mode": {"cancel"}}
+		http.Redirect(w, r, withQuery(returnTo, q), http.StatusFound)
+		return
+	}
+	steamID := r.PostFormValue("steamid")
+	if !steamIDRX.MatchString(steamID) {
+		http.Error(w, "invalid Steam ID", http.StatusBadRequest)
+		return
+	}
+	p.redirect(w, r, returnTo, steamID)
+}
+
+// redirect sends the browser back to the relying party with a signed
+// positive assertion for steamID.
+func (p *provider) redirect(w http.ResponseWriter, r *http.Request, returnTo, steamID string) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	claimedID := p.baseURL + "/openid/id/" + steamID
+	q := url.Values{}
+	q.Set("openid.ns", namespace)
+	q.Set("openid.mode", "id_res")
+	q.Set("openid.op_endpoint", p.endpoint())
+	q.Set("openid.claimed_id", claimedID)
+	q.Set("openid.identity", claimedID)
+	q.Set("openid.return_to", returnTo)
+	q.Set("openid.response_nonce", time.Now().UTC().Format(time.RFC3339)+hex.EncodeToString(nonce))
+	q.Set("openid.assoc_handle", "fake")
+	q.Set("openid.signed", strings.Join(signed, ","))
+	q.Set("openid.sig", p.sign(q))
+	http.Redirect(w, r, withQuery(returnTo, q), http.StatusFound)
+}
+
+func (p *provider) sign(q url.Values) string {
+	var b strings.Builder
+	for _, field := range strings.Split(q.Get("openid.signed"), ",") {
+		fmt.Fprintf(&b, "%s:%s\n", field, q.Get("openid."+field))
+	}
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks an assertion sent back for check_authentication. Each nonce
+// is accepted once, as a real provider would.
+func (p *provider) verify(q url.Values) bool {
+	if q.Get("openid.signed") != strings.Join(signed, ",") {
+		return false
+	}
+	if !hmac.Equal([]byte(q.Get("openid.sig")), []byte(p.sign(q))) {
+		return false
+	}
+	nonce := q.Get("openid.response_nonce")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n, t := range p.nonces {
+		if time.Since(t) > time.Hour {
+			delete(p.nonces, n)
+		}
+	}
+	if _, used := p.nonces[nonce]; used {
+		return false
+	}
+	p.nonces[nonce] = time.Now()
+	return true
+}
+
+func withQuery(rawURL string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + q.Encode()
+}
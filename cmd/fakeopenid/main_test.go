@@ -0,0 +1,136 @@
+package main
+
+import (
+	"DotaReplays/internal/openid"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testRealm    = "http://localhost:4000/"
+	testReturnTo = "http://localhost:4000/v1/auth/steam/callback?state=abc"
+)
+
+// newTestProvider starts the fake provider and returns it with a client for
+// it, as the API would use.
+func newTestProvider(t *testing.T, auto bool) (*httptest.Server, *openid.Provider) {
+	t.Helper()
+	p := &provider{
+		steamID: "76561197960287930",
+		auto:    auto,
+		secret:  []byte("0123456789abcdef0123456789abcdef"),
+		nonces:  make(map[string]time.Time),
+	}
+	srv := httptest.NewServer(p.routes())
+	t.Cleanup(srv.Close)
+	p.baseURL = srv.URL
+	op := openid.New(p.endpoint())
+	op.Client = srv.Client()
+	return srv, op
+}
+
+func noRedirects(srv *httptest.Server) *http.Client {
+	c := srv.Client()
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return c
+}
+
+// callback returns the query of the redirect back to testReturnTo in res.
+func callback(t *testing.T, res *http.Response) url.Values {
+	t.Helper()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("got %s, want a redirect", res.Status)
+	}
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Scheme+"://"+loc.Host+loc.Path != "http://localhost:4000/v1/auth/steam/callback" {
+		t.Fatalf("redirected to %s", loc)
+	}
+	return loc.Query()
+}
+
+func TestFlow(t *testing.T) {
+	srv, op := newTestProvider(t, true)
+	ctx := context.Background()
+	res, err := noRedirects(srv).Get(op.AuthURL(testReturnTo, testRealm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := callback(t, res)
+	if q.Get("state") != "abc" {
+		t.Errorf("got state %q, want abc", q.Get("state"))
+	}
+
+	claimedID, err := op.Verify(ctx, q, testReturnTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steamID, err := op.SteamID(claimedID)
+	if err != nil || steamID != "76561197960287930" {
+		t.Errorf("SteamID(%q) = %q, %v", claimedID, steamID, err)
+	}
+
+	// An assertion is good for one sign-in only.
+	_, err = op.Verify(ctx, q, testReturnTo)
+	if !errors.Is(err, openid.ErrNotVerified) {
+		t.Errorf("replayed: got %v, want %v", err, openid.ErrNotVerified)
+	}
+}
+
+func TestFlowTampered(t *testing.T) {
+	srv, op := newTestProvider(t, true)
+	res, err := noRedirects(srv).Get(op.AuthURL(testReturnTo, testRealm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := callback(t, res)
+	// Someone else's Steam ID, with the signature left as it was.
+	other := srv.URL + "/openid/id/76561197960287931"
+	q.Set("openid.claimed_id", other)
+	q.Set("openid.identity", other)
+	_, err = op.Verify(context.Background(), q, testReturnTo)
+	if !errors.Is(err, openid.ErrNotVerified) {
+		t.Errorf("got %v, want %v", err, openid.ErrNotVerified)
+	}
+}
+
+func TestFlowApproveForm(t *testing.T) {
+	srv, op := newTestProvider(t, false)
+	ctx := context.Background()
+	client := noRedirects(srv)
+
+	res, err := client.PostForm(srv.URL+"/openid/approve", url.Values{
+		"return_to": {testReturnTo},
+		"steamid":   {"76561198000000001"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimedID, err := op.Verify(ctx, callback(t, res), testReturnTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steamID, _ := op.SteamID(claimedID); steamID != "76561198000000001" {
+		t.Errorf("got Steam ID %q, want 76561198000000001", steamID)
+	}
+
+	res, err = client.PostForm(srv.URL+"/openid/approve", url.Values{
+		"return_to": {testReturnTo},
+		"cancel":    {"1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = op.Verify(ctx, callback(t, res), testReturnTo)
+	if !errors.Is(err, openid.ErrCancelled) {
+		t.Errorf("cancel: got %v, want %v", err, openid.ErrCancelled)
+	}
+}
@@ -1,13 +1,15 @@
 module DotaReplays
 
-go 1.19
+go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/go-mail/mail/v2 v2.3.0
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.0
 	golang.org/x/crypto v0.6.0
 	golang.org/x/time v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
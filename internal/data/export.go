@@ -0,0 +1,81 @@
+package data
+
+import (
+	"DotaReplays/internal/trace"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+const exportBatchSize = 500
+
+// Export calls fn for every replay matching the same filters as GetAll, ignoring
+// paging. Rows are read through a server-side cursor in batches so memory use
+// stays flat however large the catalogue is. The export runs for as long as ctx
+// allows rather than the usual three seconds.
+func (m ReplayModel) Export(ctx context.Context, title string, heroes []string, filters Filters, fn func(*Replay) error) (err error) {
+	ctx, span := trace.Start(ctx, "ReplayModel.Export")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := fmt.Sprintf(`
+DECLARE replays_export NO SCROLL CURSOR FOR
+SELECT id, created_at, title, year, runtime, heroes, patch, version
+FROM replays
+WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+AND (heroes @> $2 OR $2 = '{}')
+ORDER BY %s %s, id ASC`, filters.sortColumn(), filters.sortDirection())
+	_, err = tx.ExecContext(ctx, query, title, pq.Array(heroes))
+	if err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM replays_export", exportBatchSize)
+	for {
+		n, err := m.exportBatch(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportBatchSize {
+			break
+		}
+	}
+	return tx.Commit()
+}
+
+func (m ReplayModel) exportBatch(ctx context.Context, tx *sql.Tx, fetch string, fn func(*Replay) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var replay Replay
+		err := rows.Scan(
+			&replay.ID,
+			&replay.CreatedAt,
+			&replay.Title,
+			&replay.Year,
+			&replay.Runtime,
+			pq.Array(&replay.Heroes),
+			&replay.Patch,
+			&replay.Version,
+		)
+		if err != nil {
+			return n, err
+		}
+		n++
+		err = fn(&replay)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
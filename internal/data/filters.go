@@ -38,12 +38,12 @@ func (f Filters) sortDirection() string {
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	v.Check(f.Page > 0, "page", "positive")
+	v.Check(f.Page <= 10_000_000, "page", "max_value", 10_000_000)
+	v.Check(f.PageSize > 0, "page_size", "positive")
+	v.Check(f.PageSize <= 100, "page_size", "max_value", 100)
 	// Check that the sort parameter matches a value in the safelist.
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "oneof", strings.Join(f.SortSafelist, ", "))
 }
 
 func (f Filters) limit() int {
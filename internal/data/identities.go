@@ -0,0 +1,215 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+var ErrDuplicateIdentity = errors.New("duplicate identity")
+
+const ProviderSteam = "steam"
+
+// Identity links a user to an account at an external provider. Subject is the
+// provider's identifier for that account, such as a 64-bit Steam ID.
+type Identity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityModel struct {
+	DB DBTX
+}
+
+func (m IdentityModel) Insert(identity *Identity) error {
+	query := `
+INSERT INTO identities (user_id, provider, subject)
+VALUES ($1, $2, $3)
+RETURNING id, created_at`
+	args := []any{identity.UserID, identity.Provider, identity.Subject}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "identities_provider_subject_key"`:
+			return ErrDuplicateIdentity
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m IdentityModel) Get(provider, subject string) (*Identity, error) {
+	query := `
+SELECT id, user_id, provider, subject, created_at
+FROM identities
+WHERE provider = $1 AND subject = $2`
+	var identity Identity
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &identity, nil
+}
+
+func (m IdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	query := `
+SELECT id, user_id, provider, subject, created_at
+FROM identities
+WHERE user_id = $1
+ORDER BY id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	identities := []*Identity{}
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// AuthRequest remembers a login that was sent to an external provider, so
+// that the callback can be matched to it. UserID is set when an existing user
+// is linking an identity rather than logging in. Nonce and CodeVerifier are
+// used by OpenID Connect providers and ignored by others.
+type AuthRequest struct {
+	State        string
+	Provider     string
+	UserID       *int64
+	RedirectURI  string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+type AuthRequestModel struct {
+	DB DBTX
+}
+
+// New stores a request under a fresh random state, nonce and PKCE code
+// verifier. Only a hash of the state is stored, as with tokens.
+func (m AuthRequestModel) New(provider string, userID *int64, redirectURI func(state string) string, ttl time.Duration) (*AuthRequest, error) {
+	req := &AuthRequest{
+		Provider: provider,
+		UserID:   userID,
+		Expiry:   time.Now().Add(ttl),
+	}
+	var err error
+	for _, s := range []*string{&req.State, &req.Nonce, &req.CodeVerifier} {
+		*s, err = randomString()
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.RedirectURI = redirectURI(req.State)
+	stateHash := sha256.Sum256([]byte(req.State))
+	query := `
+INSERT INTO auth_requests (state_hash, provider, user_id, redirect_uri, nonce, code_verifier, expiry)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	args := []any{stateHash[:], req.Provider, req.UserID, req.RedirectURI, req.Nonce, req.CodeVerifier, req.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Consume deletes and returns the unexpired request for state, so that each
+// state can only be used once.
+func (m AuthRequestModel) Consume(provider, state string) (*AuthRequest, error) {
+	stateHash := sha256.Sum256([]byte(state))
+	query := `
+DELETE FROM auth_requests
+WHERE state_hash = $1 AND provider = $2
+RETURNING user_id, redirect_uri, nonce, code_verifier, expiry`
+	req := AuthRequest{State: state, Provider: provider}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, stateHash[:], provider).Scan(
+		&req.UserID,
+		&req.RedirectURI,
+		&req.Nonce,
+		&req.CodeVerifier,
+		&req.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if time.Now().After(req.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+	return &req, nil
+}
+
+// DeleteExpired deletes the requests of sign-ins that were never completed
+// and returns how many there were, as for TokenModel.DeleteExpired.
+func (m AuthRequestModel) DeleteExpired() (int64, error) {
+	query := `
+DELETE FROM auth_requests
+WHERE expiry < $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// randomString returns 32 random bytes in unpadded base32, which is also a
+// valid PKCE code verifier.
+func randomString() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"time"
+)
+
+// ReplayImporter inserts many replays inside a single transaction. Nothing is
+// visible to other connections until Commit is called.
+type ReplayImporter struct {
+	tx     *sql.Tx
+	stmt   *sql.Stmt
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (m ReplayModel) NewImporter() (*ReplayImporter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	query := `
+INSERT INTO replays (title, year, runtime, heroes, patch)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at, version`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		tx.Rollback()
+		cancel()
+		return nil, err
+	}
+	return &ReplayImporter{tx: tx, stmt: stmt, ctx: ctx, cancel: cancel}, nil
+}
+
+func (i *ReplayImporter) Insert(replay *Replay) error {
+	args := []any{replay.Title, replay.Year, replay.Runtime, pq.Array(replay.Heroes), replay.Patch}
+	return i.stmt.QueryRowContext(i.ctx, args...).Scan(&replay.ID, &replay.CreatedAt, &replay.Version)
+}
+
+func (i *ReplayImporter) Commit() error {
+	defer i.cancel()
+	i.stmt.Close()
+	return i.tx.Commit()
+}
+
+// Rollback discards every insert. It is safe to call after Commit, in which
+// case it does nothing.
+func (i *ReplayImporter) Rollback() error {
+	defer i.cancel()
+	i.stmt.Close()
+	err := i.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobDead      = "dead"
+)
+
+var JobStatuses = []string{JobPending, JobRunning, JobCompleted, JobDead}
+
+// ErrLeaseLost is returned when a job is finished by a worker that no longer
+// holds it: its lease expired and the job was claimed again or killed.
+var ErrLeaseLost = errors.New("job lease lost")
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type JobModel struct {
+	DB DBTX
+}
+
+func (m JobModel) Insert(job *Job) error {
+	query := `
+INSERT INTO jobs (kind, payload, max_attempts, run_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, status, created_at, updated_at`
+	args := []any{job.Kind, []byte(job.Payload), job.MaxAttempts, job.RunAt}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.Status, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// Claim locks the next due job and marks it as running. Jobs left running
+// for longer than lease are assumed to belong to a crashed worker and are
+// picked up again, as long as they have attempts left; see KillExpired for
+// those that do not. ErrRecordNotFound is returned when nothing is due.
+func (m JobModel) Claim(lease time.Duration) (*Job, error) {
+	query := `
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE (status = 'pending' AND run_at <= NOW())
+    OR (status = 'running' AND locked_at < NOW() - make_interval(secs => $1) AND attempts < max_attempts)
+    ORDER BY run_at, id
+    FOR UPDATE SKIP LOCKED
+    LIMIT 1
+)
+RETURNING id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`
+	var job Job
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, lease.Seconds()).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+// KillExpired moves jobs whose lease expired on their last attempt to the
+// dead state, as a job that keeps crashing or hanging its worker would
+// otherwise never stop being retried. It returns the jobs it killed.
+func (m JobModel) KillExpired(lease time.Duration) ([]*Job, error) {
+	query := `
+UPDATE jobs
+SET status = 'dead', locked_at = NULL, last_error = 'lease expired on the last attempt', updated_at = NOW()
+WHERE status = 'running' AND locked_at < NOW() - make_interval(secs => $1) AND attempts >= max_attempts
+RETURNING id, kind, payload, attempts`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []*Job{}
+	for rows.Next() {
+		job := Job{Status: JobDead}
+		err := rows.Scan(&job.ID, &job.Kind, &job.Payload, &job.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Complete marks a job as done. Like Fail and Kill, it only changes the job
+// while it is still running the attempt it was claimed for, and returns
+// ErrLeaseLost otherwise.
+func (m JobModel) Complete(job *Job) error {
+	query := `
+UPDATE jobs
+SET status = 'completed', locked_at = NULL, last_error = '', updated_at = NOW()
+WHERE id = $1 AND status = 'running' AND attempts = $2
+RETURNING status, updated_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return leaseErr(m.DB.QueryRowContext(ctx, query, job.ID, job.Attempts).Scan(&job.Status, &job.UpdatedAt))
+}
+
+// Fail records a failed attempt. The job is rescheduled for retryAt unless it
+// has used up its attempts, in which case it is moved to the dead state.
+func (m JobModel) Fail(job *Job, reason string, retryAt time.Time) error {
+	query := `
+UPDATE jobs
+SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+    run_at = $2, locked_at = NULL, last_error = $3, updated_at = NOW()
+WHERE id = $1 AND status = 'running' AND attempts = $4
+RETURNING status, run_at, updated_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return leaseErr(m.DB.QueryRowContext(ctx, query, job.ID, retryAt, reason, job.Attempts).Scan(&job.Status, &job.RunAt, &job.UpdatedAt))
+}
+
+// Kill moves a job straight to the dead state, for failures that retrying
+// cannot fix.
+func (m JobModel) Kill(job *Job, reason string) error {
+	query := `
+UPDATE jobs
+SET status = 'dead', locked_at = NULL, last_error = $2, updated_at = NOW()
+WHERE id = $1 AND status = 'running' AND attempts = $3
+RETURNING status, updated_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return leaseErr(m.DB.QueryRowContext(ctx, query, job.ID, reason, job.Attempts).Scan(&job.Status, &job.UpdatedAt))
+}
+
+func leaseErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// Retry puts a dead job back in the queue with a fresh set of attempts.
+func (m JobModel) Retry(id int64) (*Job, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+UPDATE jobs
+SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'dead'
+RETURNING id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`
+	var job Job
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+func (m JobModel) GetAll(status, kind string, filters Filters) ([]*Job, Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at
+FROM jobs
+WHERE (status = $1 OR $1 = '')
+AND (kind = $2 OR $2 = '')
+ORDER BY %s %s, id ASC
+LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, status, kind, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(
+			&totalRecords,
+			&job.ID,
+			&job.Kind,
+			&job.Payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		jobs = append(jobs, &job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return jobs, metadata, nil
+}
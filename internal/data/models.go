@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -10,18 +11,72 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// DBTX is the subset of *sql.DB and *sql.Tx used by models that can take part
+// in a transaction started with Models.WithTx.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Models struct {
-	Replays     ReplayModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	db           *sql.DB
+	ctx          context.Context
+	AuthRequests AuthRequestModel
+	EmailOutbox  EmailOutboxModel
+	Identities   IdentityModel
+	Jobs         JobModel
+	Replays      ReplayModel
+	Permissions  PermissionModel
+	Tokens       TokenModel
+	Users        UserModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Replays:     ReplayModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		db:           db,
+		AuthRequests: AuthRequestModel{DB: db},
+		EmailOutbox:  EmailOutboxModel{DB: db},
+		Identities:   IdentityModel{DB: db},
+		Jobs:         JobModel{DB: db},
+		Replays:      ReplayModel{DB: db},
+		Permissions:  PermissionModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Users:        UserModel{DB: db},
+	}
+}
+
+// Ping checks that the database can be reached.
+func (m Models) Ping(ctx context.Context) error {
+	return m.db.PingContext(ctx)
+}
+
+// WithTx runs fn with models bound to a single transaction, committing if fn
+// returns nil and rolling back otherwise. Replays manages its own
+// transactions and is left on the connection pool.
+func (m Models) WithTx(fn func(tx Models) error) error {
+	tx, err := m.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	txModels := Models{
+		db:           m.db,
+		AuthRequests: AuthRequestModel{DB: tx},
+		EmailOutbox:  EmailOutboxModel{DB: tx},
+		Identities:   IdentityModel{DB: tx},
+		Jobs:         JobModel{DB: tx},
+		Replays:      m.Replays,
+		Permissions:  PermissionModel{DB: tx},
+		Tokens:       TokenModel{DB: tx},
+		Users:        UserModel{DB: tx},
+	}
+	if m.ctx != nil {
+		txModels = txModels.WithContext(m.ctx)
+	}
+	err = fn(txModels)
+	if err != nil {
+		return err
 	}
+	return tx.Commit()
 }
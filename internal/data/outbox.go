@@ -0,0 +1,194 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+	// EmailAbandoned is a message that will not be retried. Its template
+	// data has been discarded along with the tokens it held.
+	EmailAbandoned = "abandoned"
+)
+
+// Email is an outgoing message recorded in the outbox. It is written in the
+// same transaction as the change that caused it, so that a message is never
+// lost or sent for a change that was rolled back.
+type Email struct {
+	ID        int64          `json:"id"`
+	UserID    *int64         `json:"user_id,omitempty"`
+	Recipient string         `json:"recipient"`
+	Locale    string         `json:"locale"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data,omitempty"`
+	Status    string         `json:"status"`
+	Attempts  int            `json:"attempts"`
+	LastError string         `json:"last_error,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	SentAt    *time.Time     `json:"sent_at,omitempty"`
+}
+
+type EmailOutboxModel struct {
+	DB DBTX
+}
+
+func (m EmailOutboxModel) Insert(email *Email) error {
+	data, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+	query := `
+INSERT INTO email_outbox (user_id, recipient, locale, template, data)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, status, created_at`
+	args := []any{email.UserID, email.Recipient, email.Locale, email.Template, data}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&email.ID, &email.Status, &email.CreatedAt)
+}
+
+func (m EmailOutboxModel) Get(id int64) (*Email, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+SELECT id, user_id, recipient, locale, template, data, status, attempts, last_error, created_at, sent_at
+FROM email_outbox
+WHERE id = $1`
+	var (
+		email Email
+		data  []byte
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&email.ID,
+		&email.UserID,
+		&email.Recipient,
+		&email.Locale,
+		&email.Template,
+		&data,
+		&email.Status,
+		&email.Attempts,
+		&email.LastError,
+		&email.CreatedAt,
+		&email.SentAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	err = json.Unmarshal(data, &email.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+// MarkSent records that the message was sent and discards its template data,
+// so that the plaintext tokens it held are not kept once they are delivered.
+func (m EmailOutboxModel) MarkSent(email *Email) error {
+	query := `
+UPDATE email_outbox
+SET status = 'sent', attempts = attempts + 1, last_error = '', sent_at = NOW(), data = '{}'
+WHERE id = $1
+RETURNING status, attempts, sent_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, email.ID).Scan(&email.Status, &email.Attempts, &email.SentAt)
+	if err != nil {
+		return err
+	}
+	email.Data = nil
+	return nil
+}
+
+func (m EmailOutboxModel) MarkFailed(email *Email, reason string) error {
+	query := `
+UPDATE email_outbox
+SET status = 'failed', attempts = attempts + 1, last_error = $2
+WHERE id = $1
+RETURNING status, attempts`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, email.ID, reason).Scan(&email.Status, &email.Attempts)
+}
+
+// Abandon gives up on a message that could not be sent and discards its
+// template data, as MarkSent does. A message already sent is left alone.
+func (m EmailOutboxModel) Abandon(id int64) error {
+	query := `
+UPDATE email_outbox
+SET status = 'abandoned', data = '{}'
+WHERE id = $1 AND status <> 'sent'`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// CountSince returns how many messages using template were queued for the
+// user after since, which is used to throttle user-triggered emails.
+func (m EmailOutboxModel) CountSince(userID int64, template string, since time.Time) (int, error) {
+	query := `
+SELECT count(*)
+FROM email_outbox
+WHERE user_id = $1 AND template = $2 AND created_at > $3`
+	var count int
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID, template, since).Scan(&count)
+	return count, err
+}
+
+// GetAllForUser returns every message sent to the user, newest first. The
+// template data is left out, as it holds the tokens of messages that are
+// still waiting to be sent.
+func (m EmailOutboxModel) GetAllForUser(userID int64) ([]*Email, error) {
+	query := `
+SELECT id, user_id, recipient, locale, template, status, attempts, last_error, created_at, sent_at
+FROM email_outbox
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	emails := []*Email{}
+	for rows.Next() {
+		var email Email
+		err := rows.Scan(
+			&email.ID,
+			&email.UserID,
+			&email.Recipient,
+			&email.Locale,
+			&email.Template,
+			&email.Status,
+			&email.Attempts,
+			&email.LastError,
+			&email.CreatedAt,
+			&email.SentAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, &email)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"github.com/lib/pq"
 	"time"
 )
@@ -19,19 +18,77 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 INSERT INTO users_permissions
-SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+ON CONFLICT DO NOTHING`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
 
+// SetForUser replaces the user's permissions with codes. Run it inside
+// Models.WithTx so that the user is never left without permissions midway.
+func (m PermissionModel) SetForUser(userID int64, codes ...string) error {
+	query := `
+DELETE FROM users_permissions
+WHERE user_id = $1 AND permission_id NOT IN (
+    SELECT permissions.id FROM permissions WHERE permissions.code = ANY($2)
+)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+	return m.AddForUser(userID, codes...)
+}
+
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+DELETE FROM users_permissions
+WHERE user_id = $1 AND permission_id IN (
+    SELECT permissions.id FROM permissions WHERE permissions.code = ANY($2)
+)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// GetAll returns the code of every permission that can be granted.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+SELECT code
+FROM permissions
+ORDER BY code`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	query := `
 SELECT permissions.code
@@ -4,45 +4,81 @@ import (
 	"DotaReplays/internal/validator"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
+	"reflect"
+	"regexp"
 	"time"
 )
 
+var PatchRX = regexp.MustCompile(`^\d+\.\d{2}[a-z]?$`)
+
 type Replay struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Heroes    []string  `json:"heroes,omitempty"`
+	Title     string    `json:"title" validate:"required,max=500"`
+	Year      int32     `json:"year,omitempty" validate:"required,min=2011,not_future"`
+	Runtime   Runtime   `json:"runtime,omitempty" validate:"required,positive"`
+	Heroes    []string  `json:"heroes,omitempty" validate:"required,len=10,unique,dive,required,max=100"`
+	Patch     string    `json:"patch,omitempty" validate:"patch"`
 	Version   int32     `json:"version"`
+
+	runtimeFormat RuntimeFormat
+}
+
+// SetRuntimeFormat chooses how the runtime is rendered when the replay is
+// marshalled to JSON. The default is the "N mins" format.
+func (r *Replay) SetRuntimeFormat(f RuntimeFormat) {
+	r.runtimeFormat = f
+}
+
+func (r *Replay) RuntimeFormat() RuntimeFormat {
+	if r.runtimeFormat == "" {
+		return RuntimeMinutes
+	}
+	return r.runtimeFormat
+}
+
+func (r *Replay) MarshalJSON() ([]byte, error) {
+	type replayAlias Replay
+	aux := struct {
+		*replayAlias
+		Runtime json.RawMessage `json:"runtime,omitempty"`
+	}{replayAlias: (*replayAlias)(r)}
+	if r.Runtime != 0 {
+		aux.Runtime = r.Runtime.marshalJSON(r.RuntimeFormat())
+	}
+	return json.Marshal(aux)
+}
+
+func init() {
+	validator.RegisterRule("not_future", func(value reflect.Value, _ string) bool {
+		return value.Int() <= int64(time.Now().Year())
+	})
+	validator.RegisterRule("positive", func(value reflect.Value, _ string) bool {
+		return value.Int() > 0
+	})
+	validator.RegisterRule("patch", func(value reflect.Value, _ string) bool {
+		return validator.Matches(value.String(), PatchRX)
+	})
 }
 
 func ValidateReplay(v *validator.Validator, replay *Replay) {
-	v.Check(replay.Title != "", "title", "must be provided")
-	v.Check(len(replay.Title) <= 500, "title", "must not be more than 500 bytes long")
-	v.Check(replay.Year != 0, "year", "must be provided")
-	v.Check(replay.Year >= 2011, "year", "must be greater than 2011")
-	v.Check(replay.Year <= int32(time.Now().Year()), "year", "must not be in the future")
-	v.Check(replay.Runtime != 0, "runtime", "must be provided")
-	v.Check(replay.Runtime > 0, "runtime", "must be a positive integer")
-	v.Check(replay.Heroes != nil, "heroes", "must be provided")
-	v.Check(len(replay.Heroes) == 10, "heroes", "must contain 10 heroes")
-	v.Check(validator.Unique(replay.Heroes), "heroes", "must not contain duplicate values")
+	v.Struct(replay)
 }
 
 type ReplayModel struct {
-	DB *sql.DB
+	DB TxBeginner
 }
 
 func (m ReplayModel) Insert(replay *Replay) error {
 	query := `
-INSERT INTO replays (title, year, runtime, heroes)
-VALUES ($1, $2, $3, $4)
+INSERT INTO replays (title, year, runtime, heroes, patch)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING id, created_at, version`
-	args := []interface{}{replay.Title, replay.Year, replay.Runtime, pq.Array(replay.Heroes)}
+	args := []interface{}{replay.Title, replay.Year, replay.Runtime, pq.Array(replay.Heroes), replay.Patch}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	return m.DB.QueryRowContext(ctx, query, args...).Scan(&replay.ID, &replay.CreatedAt, &replay.Version)
@@ -53,7 +89,7 @@ func (m ReplayModel) Get(id int64) (*Replay, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-SELECT id, created_at, title, year, runtime, heroes, version
+SELECT id, created_at, title, year, runtime, heroes, patch, version
 FROM replays
 WHERE id = $1`
 	var replay Replay
@@ -66,6 +102,7 @@ WHERE id = $1`
 		&replay.Year,
 		&replay.Runtime,
 		pq.Array(&replay.Heroes),
+		&replay.Patch,
 		&replay.Version,
 	)
 	if err != nil {
@@ -82,14 +119,15 @@ WHERE id = $1`
 func (m ReplayModel) Update(replay *Replay) error {
 	query := `
 UPDATE replays
-SET title = $1, year = $2, runtime = $3, heroes = $4, version = version + 1
-WHERE id = $5 AND version = $6
+SET title = $1, year = $2, runtime = $3, heroes = $4, patch = $5, version = version + 1
+WHERE id = $6 AND version = $7
 RETURNING version`
 	args := []interface{}{
 		replay.Title,
 		replay.Year,
 		replay.Runtime,
 		pq.Array(replay.Heroes),
+		replay.Patch,
 		replay.ID,
 		replay.Version,
 	}
@@ -132,7 +170,7 @@ WHERE id = $1`
 
 func (m ReplayModel) GetAll(title string, heroes []string, filters Filters) ([]*Replay, Metadata, error) {
 	query := fmt.Sprintf(`
-SELECT count(*) OVER(), id, created_at, title, year, runtime, heroes, version
+SELECT count(*) OVER(), id, created_at, title, year, runtime, heroes, patch, version
 FROM replays
 WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 AND (heroes @> $2 OR $2 = '{}')
@@ -158,6 +196,7 @@ LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 			&replay.Year,
 			&replay.Runtime,
 			pq.Array(&replay.Heroes),
+			&replay.Patch,
 			&replay.Version,
 		)
 		if err != nil {
@@ -1,41 +1,166 @@
 package data
 
 import (
-	"errors"
+	"DotaReplays/internal/i18n"
+	"bytes"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
-var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
+var ErrInvalidRuntimeFormat = i18n.Errorf("invalid_runtime_format")
 
+// Runtime is the length of a replay in seconds.
 type Runtime int32
 
-func (r Runtime) MarshalJSON() ([]byte, error) {
-	jsonValue := fmt.Sprintf("%d mins", r)
+type RuntimeFormat string
+
+const (
+	RuntimeMinutes RuntimeFormat = "mins"
+	RuntimeClock   RuntimeFormat = "clock"
+	RuntimeHMS     RuntimeFormat = "hms"
+	RuntimeISO     RuntimeFormat = "iso"
+	RuntimeSeconds RuntimeFormat = "seconds"
+)
 
-	quotedJSONValue := strconv.Quote(jsonValue)
-	return []byte(quotedJSONValue), nil
+var RuntimeFormats = []string{
+	string(RuntimeMinutes),
+	string(RuntimeClock),
+	string(RuntimeHMS),
+	string(RuntimeISO),
+	string(RuntimeSeconds),
 }
 
-func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+var (
+	minutesRX = regexp.MustCompile(`^(\d+) ?mins?$`)
+	hmsRX     = regexp.MustCompile(`^(?:(\d+)h)? ?(?:(\d+)m)? ?(?:(\d+)s)?$`)
+	clockRX   = regexp.MustCompile(`^(?:(\d+):)?(\d+):([0-5]\d)$`)
+	isoRX     = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+)
 
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
-	if err != nil {
-		return ErrInvalidRuntimeFormat
+func (r Runtime) hms() (int, int, int) {
+	s := int(r)
+	return s / 3600, s % 3600 / 60, s % 60
+}
+
+// Format renders the runtime in the given format. The "mins" format, which is
+// also used for unknown formats, truncates to whole minutes for compatibility
+// with clients written before runtimes had second precision.
+func (r Runtime) Format(f RuntimeFormat) string {
+	h, m, s := r.hms()
+	switch f {
+	case RuntimeClock:
+		if h > 0 {
+			return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+		}
+		return fmt.Sprintf("%d:%02d", m, s)
+	case RuntimeHMS:
+		var parts []string
+		if h > 0 {
+			parts = append(parts, fmt.Sprintf("%dh", h))
+		}
+		if m > 0 {
+			parts = append(parts, fmt.Sprintf("%dm", m))
+		}
+		if s > 0 || len(parts) == 0 {
+			parts = append(parts, fmt.Sprintf("%ds", s))
+		}
+		return strings.Join(parts, " ")
+	case RuntimeISO:
+		iso := "PT"
+		if h > 0 {
+			iso += fmt.Sprintf("%dH", h)
+		}
+		if m > 0 {
+			iso += fmt.Sprintf("%dM", m)
+		}
+		if s > 0 || iso == "PT" {
+			iso += fmt.Sprintf("%dS", s)
+		}
+		return iso
+	case RuntimeSeconds:
+		return strconv.Itoa(int(r))
+	default:
+		return fmt.Sprintf("%d mins", int(r)/60)
+	}
+}
+
+func (r Runtime) marshalJSON(f RuntimeFormat) []byte {
+	if f == RuntimeSeconds {
+		return []byte(r.Format(f))
 	}
+	return []byte(strconv.Quote(r.Format(f)))
+}
 
-	parts := strings.Split(unquotedJSONValue, " ")
+func (r Runtime) MarshalJSON() ([]byte, error) {
+	return r.marshalJSON(RuntimeMinutes), nil
+}
 
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+// UnmarshalJSON accepts a JSON number of seconds or any string understood by
+// ParseRuntime.
+func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	jsonValue = bytes.TrimSpace(jsonValue)
+	if len(jsonValue) > 0 && jsonValue[0] != '"' {
+		i, err := strconv.ParseInt(string(jsonValue), 10, 32)
+		if err != nil {
+			return ErrInvalidRuntimeFormat
+		}
+		*r = Runtime(i)
+		return nil
 	}
 
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
 
-	*r = Runtime(i)
-	return nil
+	*r, err = ParseRuntime(unquotedJSONValue)
+	return err
+}
+
+// ParseRuntime understands "72 mins", "1h 12m 15s", "72:15", "1:12:15", an
+// ISO 8601 duration such as "PT1H12M15S" and a plain number of seconds.
+func ParseRuntime(s string) (Runtime, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidRuntimeFormat
+	}
+	var h, m, sec string
+	if match := minutesRX.FindStringSubmatch(s); match != nil {
+		m = match[1]
+	} else if match := clockRX.FindStringSubmatch(s); match != nil {
+		h, m, sec = match[1], match[2], match[3]
+		// Only the leading field may run past its unit, as in "72:15";
+		// "1:75:00" is a typo rather than 2h 15m.
+		if n, _ := strconv.Atoi(m); h != "" && n >= 60 {
+			return 0, ErrInvalidRuntimeFormat
+		}
+	} else if match := isoRX.FindStringSubmatch(strings.ToUpper(s)); match != nil && len(s) > 2 {
+		h, m, sec = match[1], match[2], match[3]
+	} else if match := hmsRX.FindStringSubmatch(strings.ToLower(s)); match != nil {
+		h, m, sec = match[1], match[2], match[3]
+	} else if _, err := strconv.Atoi(s); err == nil {
+		sec = s
+	} else {
+		return 0, ErrInvalidRuntimeFormat
+	}
+	total := int64(0)
+	for _, part := range []struct {
+		value string
+		scale int64
+	}{{h, 3600}, {m, 60}, {sec, 1}} {
+		if part.value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(part.value, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidRuntimeFormat
+		}
+		total += n * part.scale
+		if total > 1<<31-1 {
+			return 0, ErrInvalidRuntimeFormat
+		}
+	}
+	return Runtime(total), nil
 }
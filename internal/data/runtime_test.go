@@ -0,0 +1,38 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRuntime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Runtime
+	}{
+		{"72 mins", 72 * 60},
+		{"1h 12m 15s", 4335},
+		{"72:15", 4335},
+		{"1:12:15", 4335},
+		{"0:59", 59},
+		{"1:05:00", 3900},
+		{"1:5:00", 3900},
+		{"PT1H12M15S", 4335},
+		{"4335", 4335},
+	}
+	for _, tt := range tests {
+		got, err := ParseRuntime(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRuntime(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseRuntimeInvalid(t *testing.T) {
+	for _, in := range []string{"", "72:99", "72:60", "1:75:00", "1:60:00", "1:12:75", "1:12:5", "PT", "12 hours"} {
+		got, err := ParseRuntime(in)
+		if !errors.Is(err, ErrInvalidRuntimeFormat) {
+			t.Errorf("ParseRuntime(%q) = %d, %v, want %v", in, got, err, ErrInvalidRuntimeFormat)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"DotaReplays/internal/validator"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SimilarityWeights struct {
+	Heroes float64
+	Patch  float64
+	Year   float64
+}
+
+type SimilarReplay struct {
+	*Replay
+	Score float64 `json:"score"`
+}
+
+// MarshalJSON adds the score to the replay's own fields. Without it the
+// embedded Replay's MarshalJSON would be promoted and the score left out.
+func (s SimilarReplay) MarshalJSON() ([]byte, error) {
+	js, err := s.Replay.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	score, err := json.Marshal(s.Score)
+	if err != nil {
+		return nil, err
+	}
+	js = bytes.TrimSuffix(js, []byte("}"))
+	if len(js) > 1 {
+		js = append(js, ',')
+	}
+	js = append(js, `"score":`...)
+	js = append(js, score...)
+	return append(js, '}'), nil
+}
+
+func ValidateSimilarityWeights(v *validator.Validator, w SimilarityWeights) {
+	finite := true
+	for _, weight := range []struct {
+		key   string
+		value float64
+	}{{"heroes_weight", w.Heroes}, {"patch_weight", w.Patch}, {"year_weight", w.Year}} {
+		if math.IsInf(weight.value, 0) || math.IsNaN(weight.value) {
+			v.AddError(weight.key, "finite")
+			finite = false
+			continue
+		}
+		v.Check(weight.value >= 0, weight.key, "non_negative")
+	}
+	if finite {
+		v.Check(w.Heroes+w.Patch+w.Year > 0, "weights", "any_weight_positive")
+	}
+}
+
+// patchNumber turns a patch version such as "7.35d" into 735 so that two
+// patches can be compared by distance. The letter suffix is ignored.
+func patchNumber(patch string) int {
+	major, minor, found := strings.Cut(patch, ".")
+	if !found || len(minor) < 2 {
+		return 0
+	}
+	ma, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	mi, err := strconv.Atoi(minor[:2])
+	if err != nil {
+		return 0
+	}
+	return ma*100 + mi
+}
+
+func splitSides(heroes []string) ([]string, []string) {
+	if len(heroes) <= 5 {
+		return heroes, []string{}
+	}
+	return heroes[:5], heroes[5:]
+}
+
+// GetSimilar scores every other replay sharing at least one hero with the given
+// replay. Hero overlap is counted per side (the first five heroes are Radiant,
+// the last five Dire) and the better of the straight and swapped orientations
+// is used, so the same matchup played from the other side still ranks highly.
+func (m ReplayModel) GetSimilar(replay *Replay, weights SimilarityWeights, filters Filters) ([]*SimilarReplay, Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, created_at, title, year, runtime, heroes, patch, version, score
+FROM (
+	SELECT *, $5::float8 * GREATEST(
+		cardinality(ARRAY(SELECT unnest(heroes[1:5]) INTERSECT SELECT unnest($3::text[]))) +
+		cardinality(ARRAY(SELECT unnest(heroes[6:10]) INTERSECT SELECT unnest($4::text[]))),
+		cardinality(ARRAY(SELECT unnest(heroes[1:5]) INTERSECT SELECT unnest($4::text[]))) +
+		cardinality(ARRAY(SELECT unnest(heroes[6:10]) INTERSECT SELECT unnest($3::text[])))
+	)::float8 / 10
+	+ $6::float8 * CASE WHEN patch = '' OR $9::int = 0 THEN 0
+		ELSE 1 / (1 + abs(split_part(patch, '.', 1)::int * 100 + left(split_part(patch, '.', 2), 2)::int - $9::int))::float8
+	END
+	+ $7::float8 * (1 / (1 + abs(year - $8::int))::float8) AS score
+	FROM replays
+	WHERE id <> $1 AND heroes && $2
+) AS candidates
+ORDER BY %s %s, id ASC
+LIMIT $10 OFFSET $11`, filters.sortColumn(), filters.sortDirection())
+	radiant, dire := splitSides(replay.Heroes)
+	args := []any{
+		replay.ID,
+		pq.Array(replay.Heroes),
+		pq.Array(radiant),
+		pq.Array(dire),
+		weights.Heroes,
+		weights.Patch,
+		weights.Year,
+		replay.Year,
+		patchNumber(replay.Patch),
+		filters.limit(),
+		filters.offset(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	similar := []*SimilarReplay{}
+	for rows.Next() {
+		s := SimilarReplay{Replay: &Replay{}}
+		err := rows.Scan(
+			&totalRecords,
+			&s.Replay.ID,
+			&s.Replay.CreatedAt,
+			&s.Replay.Title,
+			&s.Replay.Year,
+			&s.Replay.Runtime,
+			pq.Array(&s.Replay.Heroes),
+			&s.Replay.Patch,
+			&s.Replay.Version,
+			&s.Score,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		similar = append(similar, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return similar, metadata, nil
+}
@@ -0,0 +1,37 @@
+package data
+
+import (
+	"DotaReplays/internal/validator"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSimilarityWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights SimilarityWeights
+		want    map[string][]string
+	}{
+		{"defaults", SimilarityWeights{1, 0.5, 0.25}, map[string][]string{}},
+		{"one positive", SimilarityWeights{0, 0, 1}, map[string][]string{}},
+		{"negative", SimilarityWeights{-1, 0, 0}, map[string][]string{"heroes_weight": {"non_negative"}, "weights": {"any_weight_positive"}}},
+		{"all zero", SimilarityWeights{0, 0, 0}, map[string][]string{"weights": {"any_weight_positive"}}},
+		{"infinite", SimilarityWeights{math.Inf(1), 0, 0}, map[string][]string{"heroes_weight": {"finite"}}},
+		{"negative infinite", SimilarityWeights{1, math.Inf(-1), 0}, map[string][]string{"patch_weight": {"finite"}}},
+		{"not a number", SimilarityWeights{1, 0, math.NaN()}, map[string][]string{"year_weight": {"finite"}}},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateSimilarityWeights(v, tt.weights)
+		got := make(map[string][]string)
+		for key, errs := range v.Errors {
+			for _, e := range errs {
+				got[key] = append(got[key], e.Code)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -7,20 +7,31 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 )
 
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeEmailChange    = "email-change"
+	ScopeEmailCancel    = "email-change-cancel"
+	ScopeRefresh        = "refresh"
+	// ScopeReauthentication proves that the user signed in again moments ago,
+	// for accounts created through a provider, whose password they never knew.
+	ScopeReauthentication = "reauthentication"
 )
 
+var ErrTokenReused = errors.New("refresh token reused")
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	Payload   string    `json:"-"`
+	Family    string    `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -41,12 +52,12 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 }
 
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
-	v.Check(tokenPlaintext != "", "token", "must be provided")
-	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+	v.Check(tokenPlaintext != "", "token", "required")
+	v.Check(len(tokenPlaintext) == 26, "token", "len_bytes", 26)
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -58,11 +69,42 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewWithPayload creates a token that carries a value, such as the address an
+// email change is waiting to be confirmed for.
+func (m TokenModel) NewWithPayload(userID int64, ttl time.Duration, scope, payload string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.Payload = payload
+	err = m.Insert(token)
+	return token, err
+}
+
+// NewRefresh creates a refresh token in family, or in a new family if family
+// is empty. All the refresh tokens that descend from one login by rotation
+// share a family.
+func (m TokenModel) NewRefresh(userID int64, ttl time.Duration, family string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	token.Family = family
+	if token.Family == "" {
+		token.Family, err = randomString()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = m.Insert(token)
+	return token, err
+}
+
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-INSERT INTO tokens (hash, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+INSERT INTO tokens (hash, user_id, expiry, scope, payload, family)
+VALUES ($1, $2, $3, $4, $5, $6)`
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Payload, token.Family}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -78,3 +120,135 @@ WHERE scope = $1 AND user_id = $2`
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteExpired deletes every token that has expired and returns how many
+// there were. Expired tokens are never accepted, so this only reclaims space;
+// it is given longer than usual as the table can hold a backlog of them.
+func (m TokenModel) DeleteExpired() (int64, error) {
+	query := `
+DELETE FROM tokens
+WHERE expiry <= $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Get returns the unexpired token with the given scope and plaintext.
+func (m TokenModel) Get(scope, tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+SELECT hash, user_id, expiry, scope, payload, family
+FROM tokens
+WHERE hash = $1 AND scope = $2 AND expiry > $3`
+	token := Token{Plaintext: tokenPlaintext}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], scope, time.Now()).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&token.Payload,
+		&token.Family,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &token, nil
+}
+
+// UseRefresh marks an unused, unexpired refresh token as used and returns it.
+// A used token is only ever presented again if it has leaked, as the client
+// got a new one in exchange. In that case the whole family is deleted, which
+// signs out both whoever holds the leaked token and the legitimate client, and
+// ErrTokenReused is returned.
+func (m TokenModel) UseRefresh(tokenPlaintext string) (*Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+UPDATE tokens
+SET used_at = NOW()
+WHERE hash = $1 AND scope = $2 AND expiry > $3 AND used_at IS NULL
+RETURNING user_id, expiry, family`
+	token := Token{Plaintext: tokenPlaintext, Hash: tokenHash[:], Scope: ScopeRefresh}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh, time.Now()).Scan(
+		&token.UserID,
+		&token.Expiry,
+		&token.Family,
+	)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	query = `
+DELETE FROM tokens
+WHERE family = (
+    SELECT family FROM tokens
+    WHERE hash = $1 AND scope = $2 AND used_at IS NOT NULL AND family <> ''
+)`
+	result, err := m.DB.ExecContext(ctx, query, tokenHash[:], ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected > 0 {
+		return nil, ErrTokenReused
+	}
+	return nil, ErrRecordNotFound
+}
+
+// DeleteFamily deletes every refresh token in family.
+func (m TokenModel) DeleteFamily(family string) error {
+	query := `
+DELETE FROM tokens
+WHERE scope = $1 AND family = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, ScopeRefresh, family)
+	return err
+}
+
+// GetAllForUser returns the user's unexpired tokens. Only the scope and expiry
+// are known, as the plaintext is never stored.
+func (m TokenModel) GetAllForUser(userID int64) ([]*Token, error) {
+	query := `
+SELECT user_id, expiry, scope
+FROM tokens
+WHERE user_id = $1 AND expiry > $2
+ORDER BY expiry`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []*Token{}
+	for rows.Next() {
+		var token Token
+		err := rows.Scan(&token.UserID, &token.Expiry, &token.Scope)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
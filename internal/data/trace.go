@@ -0,0 +1,130 @@
+package data
+
+import (
+	"DotaReplays/internal/trace"
+	"context"
+	"database/sql"
+	"runtime"
+	"strings"
+)
+
+// TxBeginner is a DBTX that can also start transactions, which ReplayModel
+// needs for exports and imports.
+type TxBeginner interface {
+	DBTX
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// WithContext returns models whose queries are traced as children of the
+// current span in ctx. Model methods keep their own timeouts; ctx only
+// supplies the parent span. Without a span in ctx m is returned as it is.
+func (m Models) WithContext(ctx context.Context) Models {
+	if trace.SpanFromContext(ctx) == nil {
+		return m
+	}
+	m.ctx = ctx
+	m.AuthRequests.DB = traced(ctx, m.AuthRequests.DB)
+	m.EmailOutbox.DB = traced(ctx, m.EmailOutbox.DB)
+	m.Identities.DB = traced(ctx, m.Identities.DB)
+	m.Jobs.DB = traced(ctx, m.Jobs.DB)
+	m.Permissions.DB = traced(ctx, m.Permissions.DB)
+	m.Tokens.DB = traced(ctx, m.Tokens.DB)
+	m.Users.DB = traced(ctx, m.Users.DB)
+	db := m.Replays.DB
+	if t, ok := db.(tracedBeginner); ok {
+		db = t.TxBeginner
+	}
+	m.Replays.DB = tracedBeginner{db, tracedDB{db, ctx}}
+	return m
+}
+
+func traced(ctx context.Context, db DBTX) DBTX {
+	if t, ok := db.(tracedDB); ok {
+		db = t.db
+	}
+	return tracedDB{db, ctx}
+}
+
+// tracedDB records a span for every statement, named after the model method
+// that ran it, such as ReplayModel.GetAll.
+type tracedDB struct {
+	db     DBTX
+	parent context.Context
+}
+
+func (t tracedDB) start(ctx context.Context, query string) (context.Context, *trace.Span) {
+	ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(t.parent))
+	ctx, span := trace.Start(ctx, callerName(), trace.KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.statement", strings.TrimSpace(query))
+	return ctx, span
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	result, err := t.db.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return result, err
+}
+
+// QueryContext's span ends once the query has returned its first rows; the
+// time spent reading the rest falls to the caller's span.
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	row := t.db.QueryRowContext(ctx, query, args...)
+	span.RecordError(row.Err())
+	return row
+}
+
+// tracedBeginner traces the statements of a TxBeginner. Transactions it
+// begins are not traced statement by statement; methods that use them, such
+// as ReplayModel.Export, start their own span.
+type tracedBeginner struct {
+	TxBeginner
+	tracedDB
+}
+
+func (t tracedBeginner) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.tracedDB.ExecContext(ctx, query, args...)
+}
+
+func (t tracedBeginner) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.tracedDB.QueryContext(ctx, query, args...)
+}
+
+func (t tracedBeginner) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tracedDB.QueryRowContext(ctx, query, args...)
+}
+
+// callerName returns the model method that called into the tracedDB, as
+// Type.Method without the package path.
+func callerName() string {
+	pcs := make([]uintptr, 8)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		name := frame.Function
+		if !strings.Contains(name, "internal/data.traced") {
+			name = name[strings.LastIndex(name, "/")+1:]
+			name = strings.TrimPrefix(name, "data.")
+			// Closures inside a method are reported as Method.func1.
+			if i := strings.Index(name, ".func"); i > 0 {
+				name = name[:i]
+			}
+			return name
+		}
+		if !more {
+			return "query"
+		}
+	}
+}
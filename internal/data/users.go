@@ -7,6 +7,9 @@ import (
 	"database/sql"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"reflect"
+	"regexp"
 	"time"
 )
 
@@ -19,28 +22,44 @@ var AnonymousUser = &User{}
 type User struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
+	Name      string    `json:"name" validate:"required,max=500"`
+	Email     string    `json:"email" validate:"required,email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale,omitempty" validate:"oneof=en ru kk"`
+	AvatarURL string    `json:"avatar_url,omitempty" validate:"max=2000,url"`
+	SteamID   string    `json:"steam_id,omitempty" validate:"steam_id"`
 	Version   int       `json:"-"`
 }
 
+// SteamIDRX matches a 64-bit Steam ID of an individual account.
+var SteamIDRX = regexp.MustCompile(`^7656119\d{10}$`)
+
+func init() {
+	validator.RegisterRule("url", func(value reflect.Value, _ string) bool {
+		u, err := url.Parse(value.String())
+		return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+	})
+	validator.RegisterRule("steam_id", func(value reflect.Value, _ string) bool {
+		return validator.Matches(value.String(), SteamIDRX)
+	})
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m UserModel) Insert(user *User) error {
 	query := `
-INSERT INTO users (name, email, password_hash, activated)
-VALUES ($1, $2, $3, $4)
+INSERT INTO users (name, email, password_hash, activated, locale, avatar_url, steam_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING id, created_at, version`
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale, user.AvatarURL, user.SteamID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
@@ -55,9 +74,43 @@ RETURNING id, created_at, version`
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+SELECT id, created_at, name, email, password_hash, activated, locale, avatar_url, steam_id, version
+FROM users
+WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Locale,
+		&user.AvatarURL,
+		&user.SteamID,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-SELECT id, created_at, name, email, password_hash, activated, version
+SELECT id, created_at, name, email, password_hash, activated, locale, avatar_url, steam_id, version
 FROM users
 WHERE email = $1`
 	var user User
@@ -70,6 +123,9 @@ WHERE email = $1`
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
+		&user.AvatarURL,
+		&user.SteamID,
 		&user.Version,
 	)
 	if err != nil {
@@ -86,14 +142,17 @@ WHERE email = $1`
 func (m UserModel) Update(user *User) error {
 	query := `
 UPDATE users
-SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-WHERE id = $5 AND version = $6
+SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, avatar_url = $6, steam_id = $7, version = version + 1
+WHERE id = $8 AND version = $9
 RETURNING version`
 	args := []any{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
+		user.AvatarURL,
+		user.SteamID,
 		user.ID,
 		user.Version,
 	}
@@ -137,20 +196,24 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 }
 
 func ValidateEmail(v *validator.Validator, email string) {
-	v.Check(email != "", "email", "must be provided")
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+	v.Check(email != "", "email", "required")
+	v.Check(validator.IsEmail(email), "email", "email")
 }
 
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
-	v.Check(password != "", "password", "must be provided")
-	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	ValidatePasswordPlaintextField(v, "password", password)
+}
+
+// ValidatePasswordPlaintextField checks a password given in a field with
+// another name, such as new_password, and reports errors under that key.
+func ValidatePasswordPlaintextField(v *validator.Validator, key, password string) {
+	v.Check(password != "", key, "required")
+	v.Check(len(password) >= 8, key, "min_bytes", 8)
+	v.Check(len(password) <= 72, key, "max_bytes", 72)
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
-	v.Check(user.Name != "", "name", "must be provided")
-	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
-	ValidateEmail(v, user.Email)
+	v.Struct(user)
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
 	}
@@ -162,7 +225,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
-SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.avatar_url, users.steam_id, users.version
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -180,6 +243,9 @@ AND tokens.expiry > $3`
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
+		&user.AvatarURL,
+		&user.SteamID,
 		&user.Version,
 	)
 	if err != nil {
@@ -196,3 +262,26 @@ AND tokens.expiry > $3`
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
+
+func (m UserModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+DELETE FROM users
+WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package i18n
+
+var catalogue = map[string]map[string]string{
+	// Validation messages.
+	"required": {
+		English: "must be provided",
+		Russian: "обязательное поле",
+		Kazakh:  "міндетті өріс",
+	},
+	"max_bytes": {
+		English: "must not be more than %d bytes long",
+		Russian: "должно быть не длиннее %d байт",
+		Kazakh:  "ұзындығы %d байттан аспауы керек",
+	},
+	"min_bytes": {
+		English: "must be at least %d bytes long",
+		Russian: "должно быть не короче %d байт",
+		Kazakh:  "ұзындығы кемінде %d байт болуы керек",
+	},
+	"len_bytes": {
+		English: "must be %d bytes long",
+		Russian: "должно быть длиной %d байт",
+		Kazakh:  "ұзындығы %d байт болуы керек",
+	},
+	"min_value": {
+		English: "must be at least %v",
+		Russian: "должно быть не меньше %v",
+		Kazakh:  "кемінде %v болуы керек",
+	},
+	"max_value": {
+		English: "must be a maximum of %v",
+		Russian: "должно быть не больше %v",
+		Kazakh:  "%v мәнінен аспауы керек",
+	},
+	"not_allowed_in_env": {
+		English: "%v is only allowed with -env=development",
+		Russian: "%v допускается только с -env=development",
+		Kazakh:  "%v тек -env=development кезінде рұқсат етіледі",
+	},
+	"not_equal": {
+		English: "must not be the same as %v",
+		Russian: "не должно совпадать с %v",
+		Kazakh:  "%v мәнімен бірдей болмауы керек",
+	},
+	"positive": {
+		English: "must be greater than zero",
+		Russian: "должно быть больше нуля",
+		Kazakh:  "нөлден үлкен болуы керек",
+	},
+	"non_negative": {
+		English: "must not be negative",
+		Russian: "не может быть отрицательным",
+		Kazakh:  "теріс болмауы керек",
+	},
+	"not_future": {
+		English: "must not be in the future",
+		Russian: "не может быть в будущем",
+		Kazakh:  "болашақта болмауы керек",
+	},
+	"len_value": {
+		English: "must be equal to %v",
+		Russian: "должно быть равно %v",
+		Kazakh:  "%v мәніне тең болуы керек",
+	},
+	"min_items": {
+		English: "must contain at least %d items",
+		Russian: "должно содержать не менее %d элементов",
+		Kazakh:  "кемінде %d элементтен тұруы керек",
+	},
+	"max_items": {
+		English: "must not contain more than %d items",
+		Russian: "должно содержать не более %d элементов",
+		Kazakh:  "%d элементтен аспауы керек",
+	},
+	"len_items": {
+		English: "must contain exactly %d items",
+		Russian: "должно содержать ровно %d элементов",
+		Kazakh:  "дәл %d элементтен тұруы керек",
+	},
+	"unique": {
+		English: "must not contain duplicate values",
+		Russian: "не должно содержать повторяющихся значений",
+		Kazakh:  "қайталанатын мәндер болмауы керек",
+	},
+	"email": {
+		English: "must be a valid email address",
+		Russian: "должно быть корректным адресом электронной почты",
+		Kazakh:  "жарамды электрондық пошта мекенжайы болуы керек",
+	},
+	"patch": {
+		English: "must be a valid patch version such as 7.35d",
+		Russian: "должно быть корректной версией патча, например 7.35d",
+		Kazakh:  "7.35d сияқты жарамды патч нұсқасы болуы керек",
+	},
+	"url": {
+		English: "must be an absolute http or https URL",
+		Russian: "должно быть абсолютным URL с http или https",
+		Kazakh:  "http немесе https абсолютті URL болуы керек",
+	},
+	"host": {
+		English: "must be a host name or IP address without a port",
+		Russian: "должно быть именем хоста или IP-адресом без порта",
+		Kazakh:  "порты жоқ хост аты немесе IP мекенжайы болуы керек",
+	},
+	"steam_id": {
+		English: "must be a 17-digit Steam ID such as 76561197960287930",
+		Russian: "должно быть 17-значным Steam ID, например 76561197960287930",
+		Kazakh:  "76561197960287930 сияқты 17 таңбалы Steam ID болуы керек",
+	},
+	"oneof": {
+		English: "must be one of: %s",
+		Russian: "должно быть одним из значений: %s",
+		Kazakh:  "мына мәндердің бірі болуы керек: %s",
+	},
+	"integer": {
+		English: "must be an integer value",
+		Russian: "должно быть целым числом",
+		Kazakh:  "бүтін сан болуы керек",
+	},
+	"number": {
+		English: "must be a number",
+		Russian: "должно быть числом",
+		Kazakh:  "сан болуы керек",
+	},
+	"finite": {
+		English: "must be a finite number",
+		Russian: "должно быть конечным числом",
+		Kazakh:  "шекті сан болуы керек",
+	},
+	"boolean": {
+		English: "must be a boolean value",
+		Russian: "должно быть логическим значением",
+		Kazakh:  "логикалық мән болуы керек",
+	},
+	"any_weight_positive": {
+		English: "at least one weight must be greater than zero",
+		Russian: "хотя бы один вес должен быть больше нуля",
+		Kazakh:  "кемінде бір салмақ нөлден үлкен болуы керек",
+	},
+	"duplicate_email": {
+		English: "a user with this email address already exists",
+		Russian: "пользователь с таким адресом электронной почты уже существует",
+		Kazakh:  "бұл электрондық пошта мекенжайымен пайдаланушы бұрыннан тіркелген",
+	},
+	"invalid_activation_token": {
+		English: "invalid or expired activation token",
+		Russian: "недействительный или просроченный токен активации",
+		Kazakh:  "белсендіру токені жарамсыз немесе мерзімі өткен",
+	},
+	"invalid_token": {
+		English: "invalid or expired token",
+		Russian: "недействительный или просроченный токен",
+		Kazakh:  "токен жарамсыз немесе мерзімі өткен",
+	},
+	"incorrect_password": {
+		English: "is incorrect",
+		Russian: "указан неверно",
+		Kazakh:  "қате көрсетілген",
+	},
+	"email_unchanged": {
+		English: "must be different from the current email address",
+		Russian: "должен отличаться от текущего адреса электронной почты",
+		Kazakh:  "ағымдағы электрондық пошта мекенжайынан өзгеше болуы керек",
+	},
+	"invalid_runtime_format": {
+		English: "invalid runtime format",
+		Russian: "неверный формат продолжительности",
+		Kazakh:  "ұзақтық пішімі қате",
+	},
+
+	// Request body decoding.
+	"body_malformed_at": {
+		English: "body contains badly-formed JSON (at character %d)",
+		Russian: "тело запроса содержит некорректный JSON (символ %d)",
+		Kazakh:  "сұраныс денесінде қате JSON бар (%d-таңба)",
+	},
+	"body_malformed": {
+		English: "body contains badly-formed JSON",
+		Russian: "тело запроса содержит некорректный JSON",
+		Kazakh:  "сұраныс денесінде қате JSON бар",
+	},
+	"body_wrong_type_field": {
+		English: "body contains incorrect JSON type for field %q",
+		Russian: "тело запроса содержит неверный тип JSON для поля %q",
+		Kazakh:  "сұраныс денесінде %q өрісі үшін JSON түрі қате",
+	},
+	"body_wrong_type_at": {
+		English: "body contains incorrect JSON type (at character %d)",
+		Russian: "тело запроса содержит неверный тип JSON (символ %d)",
+		Kazakh:  "сұраныс денесінде JSON түрі қате (%d-таңба)",
+	},
+	"body_empty": {
+		English: "body must not be empty",
+		Russian: "тело запроса не может быть пустым",
+		Kazakh:  "сұраныс денесі бос болмауы керек",
+	},
+	"body_unknown_key": {
+		English: "body contains unknown key %s",
+		Russian: "тело запроса содержит неизвестный ключ %s",
+		Kazakh:  "сұраныс денесінде белгісіз %s кілті бар",
+	},
+	"body_too_large": {
+		English: "body must not be larger than %d bytes",
+		Russian: "тело запроса не может быть больше %d байт",
+		Kazakh:  "сұраныс денесі %d байттан аспауы керек",
+	},
+	"body_multiple_values": {
+		English: "body must only contain a single JSON value",
+		Russian: "тело запроса должно содержать только одно значение JSON",
+		Kazakh:  "сұраныс денесінде тек бір JSON мәні болуы керек",
+	},
+
+	// Bulk import rows.
+	"csv_header_missing": {
+		English: "csv input must start with a header row",
+		Russian: "csv должен начинаться со строки заголовка",
+		Kazakh:  "csv тақырып жолынан басталуы керек",
+	},
+	"csv_unknown_column": {
+		English: "csv header contains unknown column %q",
+		Russian: "заголовок csv содержит неизвестный столбец %q",
+		Kazakh:  "csv тақырыбында белгісіз %q бағаны бар",
+	},
+	"csv_duplicate_column": {
+		English: "csv header contains duplicate column %q",
+		Russian: "заголовок csv содержит повторяющийся столбец %q",
+		Kazakh:  "csv тақырыбында %q бағаны қайталанады",
+	},
+	"csv_missing_column": {
+		English: "csv header is missing the %q column",
+		Russian: "в заголовке csv отсутствует столбец %q",
+		Kazakh:  "csv тақырыбында %q бағаны жоқ",
+	},
+	"csv_field_count": {
+		English: "row has %d fields, expected %d",
+		Russian: "строка содержит %d полей, ожидалось %d",
+		Kazakh:  "жолда %d өріс бар, %d күтілген",
+	},
+	"year_integer": {
+		English: "year must be an integer value",
+		Russian: "год должен быть целым числом",
+		Kazakh:  "жыл бүтін сан болуы керек",
+	},
+	"line_multiple_values": {
+		English: "line must only contain a single JSON value",
+		Russian: "строка должна содержать только одно значение JSON",
+		Kazakh:  "жолда тек бір JSON мәні болуы керек",
+	},
+	"line_too_large": {
+		English: "line %d must not be larger than %d bytes",
+		Russian: "строка %d не может быть больше %d байт",
+		Kazakh:  "%d-жол %d байттан аспауы керек",
+	},
+
+	// Problem titles and details for error responses.
+	"problem.server_error.title": {
+		English: "Server error",
+		Russian: "Ошибка сервера",
+		Kazakh:  "Сервер қатесі",
+	},
+	"problem.server_error.detail": {
+		English: "the server encountered a problem and could not process your request",
+		Russian: "на сервере произошла ошибка, и он не смог обработать ваш запрос",
+		Kazakh:  "серверде ақау туындады және сұранысыңыз өңделмеді",
+	},
+	"problem.not_found.title": {
+		English: "Resource not found",
+		Russian: "Ресурс не найден",
+		Kazakh:  "Ресурс табылмады",
+	},
+	"problem.not_found.detail": {
+		English: "the requested resource could not be found",
+		Russian: "запрошенный ресурс не найден",
+		Kazakh:  "сұралған ресурс табылмады",
+	},
+	"problem.method_not_allowed.title": {
+		English: "Method not allowed",
+		Russian: "Метод не разрешён",
+		Kazakh:  "Әдіске рұқсат жоқ",
+	},
+	"problem.method_not_allowed.detail": {
+		English: "the %s method is not supported for this resource",
+		Russian: "метод %s не поддерживается для этого ресурса",
+		Kazakh:  "бұл ресурс үшін %s әдісіне қолдау көрсетілмейді",
+	},
+	"problem.bad_request.title": {
+		English: "Malformed request",
+		Russian: "Некорректный запрос",
+		Kazakh:  "Қате сұраныс",
+	},
+	"problem.not_acceptable.title": {
+		English: "Not acceptable",
+		Russian: "Неприемлемый формат",
+		Kazakh:  "Қолайсыз пішім",
+	},
+	"problem.not_acceptable.detail": {
+		English: "the requested resource is not available in any of the media types listed in the Accept header",
+		Russian: "запрошенный ресурс недоступен ни в одном из форматов, указанных в заголовке Accept",
+		Kazakh:  "сұралған ресурс Accept тақырыбында көрсетілген пішімдердің ешқайсысында қолжетімсіз",
+	},
+	"problem.unsupported_media_type.title": {
+		English: "Unsupported media type",
+		Russian: "Неподдерживаемый тип содержимого",
+		Kazakh:  "Қолдау көрсетілмейтін мазмұн түрі",
+	},
+	"problem.unsupported_media_type.detail": {
+		English: "the %q content type is not supported for this resource",
+		Russian: "тип содержимого %q не поддерживается для этого ресурса",
+		Kazakh:  "бұл ресурс үшін %q мазмұн түріне қолдау көрсетілмейді",
+	},
+	"problem.validation_failed.title": {
+		English: "Validation failed",
+		Russian: "Ошибка проверки данных",
+		Kazakh:  "Деректерді тексеру сәтсіз аяқталды",
+	},
+	"problem.validation_failed.detail": {
+		English: "one or more fields failed validation",
+		Russian: "одно или несколько полей не прошли проверку",
+		Kazakh:  "бір немесе бірнеше өріс тексеруден өтпеді",
+	},
+	"problem.edit_conflict.title": {
+		English: "Edit conflict",
+		Russian: "Конфликт изменений",
+		Kazakh:  "Өзгерістер қақтығысы",
+	},
+	"problem.edit_conflict.detail": {
+		English: "unable to update the record due to an edit conflict, please try again",
+		Russian: "не удалось обновить запись из-за конфликта изменений, попробуйте ещё раз",
+		Kazakh:  "өзгерістер қақтығысына байланысты жазбаны жаңарту мүмкін болмады, қайталап көріңіз",
+	},
+	"problem.rate_limit_exceeded.title": {
+		English: "Rate limit exceeded",
+		Russian: "Превышен лимит запросов",
+		Kazakh:  "Сұраныс шегінен асты",
+	},
+	"problem.rate_limit_exceeded.detail": {
+		English: "rate limit exceeded",
+		Russian: "превышен лимит запросов",
+		Kazakh:  "сұраныс шегінен асты",
+	},
+	"problem.invalid_credentials.title": {
+		English: "Invalid credentials",
+		Russian: "Неверные учётные данные",
+		Kazakh:  "Тіркелгі деректері қате",
+	},
+	"problem.invalid_credentials.detail": {
+		English: "invalid authentication credentials",
+		Russian: "неверные учётные данные для входа",
+		Kazakh:  "кіру деректері қате",
+	},
+	"problem.external_auth_failed.title": {
+		English: "External sign-in failed",
+		Russian: "Ошибка внешнего входа",
+		Kazakh:  "Сыртқы кіру сәтсіз аяқталды",
+	},
+	"problem.external_auth_failed.detail": {
+		English: "the sign-in with the external provider could not be verified or has expired, please start again",
+		Russian: "не удалось подтвердить вход через внешнего провайдера или срок его действия истёк, начните заново",
+		Kazakh:  "сыртқы провайдер арқылы кіруді растау мүмкін болмады немесе оның мерзімі өтті, қайта бастаңыз",
+	},
+	"problem.identity_conflict.title": {
+		English: "Identity already linked",
+		Russian: "Учётная запись уже привязана",
+		Kazakh:  "Тіркелгі бұрыннан байланыстырылған",
+	},
+	"problem.identity_conflict.detail": {
+		English: "this external account is already linked to another user",
+		Russian: "эта внешняя учётная запись уже привязана к другому пользователю",
+		Kazakh:  "бұл сыртқы тіркелгі басқа пайдаланушыға байланыстырылған",
+	},
+	"problem.invalid_authentication_token.title": {
+		English: "Invalid authentication token",
+		Russian: "Недействительный токен аутентификации",
+		Kazakh:  "Аутентификация токені жарамсыз",
+	},
+	"problem.invalid_authentication_token.detail": {
+		English: "invalid or missing authentication token",
+		Russian: "токен аутентификации недействителен или отсутствует",
+		Kazakh:  "аутентификация токені жарамсыз немесе жоқ",
+	},
+	"problem.authentication_required.title": {
+		English: "Authentication required",
+		Russian: "Требуется аутентификация",
+		Kazakh:  "Аутентификация қажет",
+	},
+	"problem.authentication_required.detail": {
+		English: "you must be authenticated to access this resource",
+		Russian: "для доступа к этому ресурсу необходимо пройти аутентификацию",
+		Kazakh:  "бұл ресурсқа қол жеткізу үшін аутентификациядан өту керек",
+	},
+	"problem.inactive_account.title": {
+		English: "Inactive account",
+		Russian: "Учётная запись не активирована",
+		Kazakh:  "Тіркелгі белсендірілмеген",
+	},
+	"problem.inactive_account.detail": {
+		English: "your user account must be activated to access this resource",
+		Russian: "для доступа к этому ресурсу учётная запись должна быть активирована",
+		Kazakh:  "бұл ресурсқа қол жеткізу үшін тіркелгіңіз белсендірілуі керек",
+	},
+	"problem.not_permitted.title": {
+		English: "Not permitted",
+		Russian: "Доступ запрещён",
+		Kazakh:  "Рұқсат жоқ",
+	},
+	"problem.not_permitted.detail": {
+		English: "your user account doesn't have the necessary permissions to access this resource",
+		Russian: "у вашей учётной записи нет необходимых прав для доступа к этому ресурсу",
+		Kazakh:  "тіркелгіңізде бұл ресурсқа қол жеткізуге қажетті рұқсаттар жоқ",
+	},
+
+	// Shared parts of the email layout.
+	"email.greeting": {
+		English: "Hi,",
+		Russian: "Здравствуйте!",
+		Kazakh:  "Сәлеметсіз бе!",
+	},
+	"email.thanks": {
+		English: "Thanks,",
+		Russian: "С уважением,",
+		Kazakh:  "Құрметпен,",
+	},
+	"email.team": {
+		English: "The %s Team",
+		Russian: "Команда %s",
+		Kazakh:  "%s командасы",
+	},
+	"email.ignore": {
+		English: "If you did not make this request, you can safely ignore this email.",
+		Russian: "Если вы не отправляли этот запрос, просто проигнорируйте это письмо.",
+		Kazakh:  "Егер сіз бұл сұранысты жібермесеңіз, бұл хатты елемеуге болады.",
+	},
+	"email.token_once": {
+		English: "Please note that this is a one-time use token and it will expire in %s.",
+		Russian: "Обратите внимание: это одноразовый токен, он действует %s.",
+		Kazakh:  "Назар аударыңыз: бұл бір реттік токен, ол %s бойы жарамды.",
+	},
+	"email.footer": {
+		English: "You are receiving this email because of activity on your %s account.",
+		Russian: "Вы получили это письмо, потому что в вашей учётной записи %s произошло действие.",
+		Kazakh:  "Сіз бұл хатты %s тіркелгіңіздегі әрекетке байланысты алдыңыз.",
+	},
+}
@@ -0,0 +1,103 @@
+// Package i18n holds the message catalogue for every user-facing string the
+// API produces. Messages are keyed by stable codes so that the same code can
+// be rendered in whichever locale the client prefers.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	English = "en"
+	Russian = "ru"
+	Kazakh  = "kk"
+)
+
+const DefaultLocale = English
+
+var Supported = []string{English, Russian, Kazakh}
+
+func IsSupported(locale string) bool {
+	for _, l := range Supported {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate renders the message for code in the given locale, falling back to
+// English when there is no translation and to the code itself when the code is
+// unknown.
+func Translate(locale, code string, args ...any) string {
+	translations, ok := catalogue[code]
+	if !ok {
+		return code
+	}
+	format, ok := translations[locale]
+	if !ok {
+		format = translations[DefaultLocale]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Match picks the supported locale the client ranks highest in an
+// Accept-Language header, or "" when none of them is acceptable.
+func Match(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if tag == "" || q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag: strings.ToLower(tag), q: q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if t.tag == "*" {
+			return DefaultLocale
+		}
+		base, _, _ := strings.Cut(t.tag, "-")
+		if IsSupported(base) {
+			return base
+		}
+	}
+	return ""
+}
+
+// Message is an error carrying a catalogue code so that it can be rendered in
+// the client's locale. Error returns the English text.
+type Message struct {
+	Code string
+	Args []any
+}
+
+func Errorf(code string, args ...any) error {
+	return &Message{Code: code, Args: args}
+}
+
+func (m *Message) Error() string {
+	return Translate(English, m.Code, m.Args...)
+}
+
+func (m *Message) Translate(locale string) string {
+	return Translate(locale, m.Code, m.Args...)
+}
@@ -0,0 +1,299 @@
+// Package jobs runs background work from a Postgres-backed queue, so that
+// queued jobs survive restarts and failed ones are retried with backoff.
+package jobs
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/jsonlog"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKind = errors.New("no handler registered for job kind")
+
+type HandlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying will not fix, so the job goes
+// straight to the dead state instead of being rescheduled.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	Timeout      time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+}
+
+type Queue struct {
+	jobs     data.JobModel
+	logger   *jsonlog.Logger
+	cfg      Config
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	onDead   map[string]HandlerFunc
+}
+
+func New(jobs data.JobModel, logger *jsonlog.Logger, cfg Config) *Queue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.Lease < cfg.Timeout {
+		cfg.Lease = 2 * cfg.Timeout
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 5
+	}
+	return &Queue{
+		jobs:     jobs,
+		logger:   logger,
+		cfg:      cfg,
+		handlers: make(map[string]HandlerFunc),
+		onDead:   make(map[string]HandlerFunc),
+	}
+}
+
+func (q *Queue) Register(kind string, fn HandlerFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = fn
+}
+
+// Handle registers a handler whose payload is decoded into T before fn is
+// called. A payload that does not decode is a permanent failure.
+func Handle[T any](q *Queue, kind string, fn func(ctx context.Context, payload T) error) {
+	q.Register(kind, func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return Permanent(err)
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// RegisterDead registers fn to be called with the payload of a job of kind
+// that the queue gives up on, so that it can clean up after the job.
+func (q *Queue) RegisterDead(kind string, fn HandlerFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onDead[kind] = fn
+}
+
+// OnDead is RegisterDead with the payload decoded into T, as for Handle.
+func OnDead[T any](q *Queue, kind string, fn func(ctx context.Context, payload T) error) {
+	q.RegisterDead(kind, func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, payload)
+	})
+}
+
+func (q *Queue) Enqueue(kind string, payload any) (*data.Job, error) {
+	return q.insert(q.jobs, kind, payload, time.Now())
+}
+
+// Schedule queues a job that will not be picked up before runAt.
+func (q *Queue) Schedule(kind string, payload any, runAt time.Time) (*data.Job, error) {
+	return q.insert(q.jobs, kind, payload, runAt)
+}
+
+// EnqueueTx queues a job as part of the transaction that tx is bound to, so
+// the job only becomes visible to workers once that transaction commits.
+func (q *Queue) EnqueueTx(tx data.Models, kind string, payload any) (*data.Job, error) {
+	return q.insert(tx.Jobs, kind, payload, time.Now())
+}
+
+func (q *Queue) insert(jobs data.JobModel, kind string, payload any, runAt time.Time) (*data.Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &data.Job{
+		Kind:        kind,
+		Payload:     raw,
+		MaxAttempts: q.cfg.MaxAttempts,
+		RunAt:       runAt,
+	}
+	err = jobs.Insert(job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Run starts the workers and blocks until ctx is cancelled and every job that
+// was already claimed has finished. Jobs run under their own timeout rather
+// than ctx, so that shutting down does not abort them half way.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		q.killExpired()
+		// Keep draining while there is work, then wait for the next tick.
+		for ctx.Err() == nil {
+			job, err := q.jobs.Claim(q.cfg.Lease)
+			if err != nil {
+				if !errors.Is(err, data.ErrRecordNotFound) {
+					q.logger.PrintError(err, nil)
+				}
+				break
+			}
+			q.process(job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// killExpired gives up on jobs whose worker crashed or hung on their last
+// attempt, which Claim no longer picks up.
+func (q *Queue) killExpired() {
+	jobs, err := q.jobs.KillExpired(q.cfg.Lease)
+	if err != nil {
+		q.logger.PrintError(err, nil)
+		return
+	}
+	for _, job := range jobs {
+		q.logger.Error(errors.New("job lease expired on the last attempt"),
+			jsonlog.Int64("job_id", job.ID),
+			jsonlog.String("kind", job.Kind),
+			jsonlog.Int("attempts", job.Attempts),
+		)
+		q.died(job)
+	}
+}
+
+// died runs the dead handler of job's kind, if there is one.
+func (q *Queue) died(job *data.Job) {
+	q.mu.RLock()
+	fn, ok := q.onDead[job.Kind]
+	q.mu.RUnlock()
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), q.cfg.Timeout)
+	defer cancel()
+	err := fn(ctx, job.Payload)
+	if err != nil {
+		q.logger.Error(err, jsonlog.Int64("job_id", job.ID), jsonlog.String("kind", job.Kind))
+	}
+}
+
+func (q *Queue) process(job *data.Job) {
+	fields := []jsonlog.Field{
+		jsonlog.Int64("job_id", job.ID),
+		jsonlog.String("kind", job.Kind),
+		jsonlog.Int("attempts", job.Attempts),
+	}
+	err := q.execute(job)
+	switch {
+	case err == nil:
+		err = q.jobs.Complete(job)
+	case errors.As(err, new(permanentError)), errors.Is(err, ErrUnknownKind):
+		q.logger.Error(err, fields...)
+		err = q.jobs.Kill(job, err.Error())
+	default:
+		jobErr := err
+		err = q.jobs.Fail(job, jobErr.Error(), time.Now().Add(Backoff(job.Attempts)))
+		// A failure that will be retried is not an error yet.
+		switch {
+		case errors.Is(err, data.ErrLeaseLost):
+			fields = append(fields, jsonlog.Err(jobErr))
+		case err != nil, job.Status == data.JobDead:
+			q.logger.Error(jobErr, fields...)
+		default:
+			q.logger.Warn("job failed, will retry", append(fields, jsonlog.Err(jobErr), jsonlog.Time("retry_at", job.RunAt))...)
+		}
+	}
+	switch {
+	case errors.Is(err, data.ErrLeaseLost):
+		// The job ran past its lease and now belongs to another worker, or
+		// was given up on. Whatever this attempt did, the job's state is no
+		// longer this worker's to record.
+		q.logger.Warn("job lease lost, result discarded", fields...)
+		return
+	case err != nil:
+		q.logger.Error(err, fields...)
+		return
+	}
+	if job.Status == data.JobDead {
+		q.died(job)
+	}
+}
+
+func (q *Queue) execute(job *data.Job) (err error) {
+	q.mu.RLock()
+	fn, ok := q.handlers[job.Kind]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), q.cfg.Timeout)
+	defer cancel()
+	return fn(ctx, job.Payload)
+}
+
+// Backoff returns how long to wait before the next attempt: 10 seconds after
+// the first failure, doubling each time up to an hour, with up to 20% jitter
+// so that jobs which failed together do not retry together.
+func Backoff(attempt int) time.Duration {
+	const (
+		base = 10 * time.Second
+		max  = time.Hour
+	)
+	d := max
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt <= 10 {
+		d = base << (attempt - 1)
+		if d > max {
+			d = max
+		}
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
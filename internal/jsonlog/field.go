@@ -0,0 +1,120 @@
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a key and typed value written to an entry's properties.
+type Field struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Field {
+	return Field{key, value}
+}
+
+func Int(key string, value int) Field {
+	return Field{key, int64(value)}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{key, value}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{key, value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{key, value}
+}
+
+// Duration is written as a whole number of nanoseconds, as log/slog does.
+func Duration(key string, value time.Duration) Field {
+	return Field{key, value}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{key, value}
+}
+
+// Err is written under the key "error".
+func Err(err error) Field {
+	return Field{"error", err}
+}
+
+// Object nests fields under key.
+func Object(key string, fields ...Field) Field {
+	return Field{key, fields}
+}
+
+// Any writes value as encoding/json would.
+func Any(key string, value any) Field {
+	return Field{key, value}
+}
+
+// Stack records the stack of the calling goroutine, for entries below the
+// configured StackLevel that still need one, such as recovered panics.
+func Stack() Field {
+	return Field{"stack", string(debug.Stack())}
+}
+
+func (c *core) writeObject(b *bytes.Buffer, fields []Field) {
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeString(b, f.Key)
+		b.WriteByte(':')
+		if c.redacted(f.Key) {
+			b.WriteString(`"[REDACTED]"`)
+			continue
+		}
+		c.writeValue(b, f.Value)
+	}
+	b.WriteByte('}')
+}
+
+func (c *core) writeValue(b *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case []Field:
+		c.writeObject(b, v)
+	case string:
+		writeString(b, v)
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case time.Duration:
+		b.WriteString(strconv.FormatInt(int64(v), 10))
+	case time.Time:
+		writeString(b, v.Format(time.RFC3339Nano))
+	case error:
+		writeString(b, v.Error())
+	default:
+		enc, err := json.Marshal(v)
+		if err != nil {
+			writeString(b, fmt.Sprint(v))
+			return
+		}
+		b.Write(enc)
+	}
+}
+
+func (c *core) redacted(key string) bool {
+	key = strings.ToLower(key)
+	for _, fragment := range c.redactKeys {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package jsonlog
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// LevelHandler reports the logger's minimum level on GET and changes it on
+// PUT, with a body such as {"level":"debug"}. It is meant for an admin port,
+// not the public API.
+func (l *Logger) LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var input struct {
+				Level *Level `json:"level"`
+			}
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&input)
+			if err != nil || input.Level == nil {
+				writeLevelJSON(w, http.StatusBadRequest, map[string]string{"error": `body must be {"level":"debug|info|warn|error|fatal|off"}`})
+				return
+			}
+			old := l.Level()
+			l.SetLevel(*input.Level)
+			l.Info("log level changed", String("from", old.String()), String("to", input.Level.String()))
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeLevelJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeLevelJSON(w, http.StatusOK, map[string]string{"level": l.Level().String()})
+	})
+}
+
+func writeLevelJSON(w http.ResponseWriter, status int, body map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
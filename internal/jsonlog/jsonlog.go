@@ -1,18 +1,29 @@
+// Package jsonlog writes structured log entries as one JSON object per line.
+// Entries carry typed fields, go to one or more sinks, and can be sampled and
+// have secrets redacted before they are written. The minimum level can be
+// changed while the program runs.
 package jsonlog
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,74 +31,232 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel reads a level name such as "debug" or "WARN".
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("jsonlog: unknown level %q", s)
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// Sink is a destination for log entries. Entries below MinLevel are not
+// written to it, so that, say, a file can keep only warnings and errors while
+// everything goes to stdout.
+type Sink struct {
+	Writer   io.Writer
+	MinLevel Level
+}
+
+// DefaultRedactKeys are the key fragments redacted when Config.RedactKeys is
+// nil.
+var DefaultRedactKeys = []string{"password", "token", "secret", "authorization", "cookie"}
+
+type Config struct {
+	// Level is the initial minimum level; see Logger.SetLevel.
+	Level Level
+	Sinks []Sink
+	// Sampling limits repeated debug, info and warning entries. Errors are
+	// never sampled.
+	Sampling *Sampling
+	// RedactKeys are matched case-insensitively against every field key,
+	// including those of nested objects; a key containing any of them has
+	// its value replaced with "[REDACTED]".
+	RedactKeys []string
+	// StackLevel is the lowest level whose entries include a stack trace,
+	// LevelFatal if nil. It is a pointer as LevelDebug is the zero Level.
+	StackLevel *Level
+}
+
+// Logger writes entries to its sinks. Loggers returned by With share the
+// sinks, level and sampling of the logger they were made from.
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	core   *core
+	fields []Field
+}
+
+type core struct {
+	level      atomic.Int32
+	sinks      []Sink
+	sampler    *sampler
+	redactKeys []string
+	stackLevel Level
+	mu         sync.Mutex
 }
 
+// New returns a logger that writes entries at or above minLevel to out.
 func New(out io.Writer, minLevel Level) *Logger {
+	return NewWithConfig(Config{Level: minLevel, Sinks: []Sink{{Writer: out}}})
+}
+
+func NewWithConfig(cfg Config) *Logger {
+	c := &core{
+		sinks:      cfg.Sinks,
+		stackLevel: LevelFatal,
+	}
+	if cfg.StackLevel != nil {
+		c.stackLevel = *cfg.StackLevel
+	}
+	redactKeys := cfg.RedactKeys
+	if redactKeys == nil {
+		redactKeys = DefaultRedactKeys
+	}
+	for _, key := range redactKeys {
+		c.redactKeys = append(c.redactKeys, strings.ToLower(key))
+	}
+	if cfg.Sampling != nil {
+		c.sampler = newSampler(*cfg.Sampling)
+	}
+	c.level.Store(int32(cfg.Level))
+	return &Logger{core: c}
+}
+
+// Level returns the current minimum level.
+func (l *Logger) Level() Level {
+	return Level(l.core.level.Load())
+}
+
+// SetLevel changes the minimum level of the logger and of every logger that
+// shares its sinks.
+func (l *Logger) SetLevel(level Level) {
+	l.core.level.Store(int32(level))
+}
+
+// Enabled reports whether entries at level would be written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level() && level < LevelOff
+}
+
+// With returns a logger that adds fields to every entry.
+func (l *Logger) With(fields ...Field) *Logger {
 	return &Logger{
-		out:      out,
-		minLevel: minLevel,
+		core:   l.core,
+		fields: append(l.fields[:len(l.fields):len(l.fields)], fields...),
 	}
 }
 
+func (l *Logger) Debug(message string, fields ...Field) {
+	l.log(LevelDebug, time.Now(), message, fields)
+}
+
+func (l *Logger) Info(message string, fields ...Field) {
+	l.log(LevelInfo, time.Now(), message, fields)
+}
+
+func (l *Logger) Warn(message string, fields ...Field) {
+	l.log(LevelWarn, time.Now(), message, fields)
+}
+
+func (l *Logger) Error(err error, fields ...Field) {
+	l.log(LevelError, time.Now(), err.Error(), fields)
+}
+
+func (l *Logger) Fatal(err error, fields ...Field) {
+	l.log(LevelFatal, time.Now(), err.Error(), fields)
+	os.Exit(1)
+}
+
+// PrintInfo, PrintError and PrintFatal log string properties, which are
+// written in key order.
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+	l.log(LevelInfo, time.Now(), message, propertyFields(properties))
 }
 
 func (l *Logger) PrintError(err error, properties map[string]string) {
-	l.print(LevelError, err.Error(), properties)
+	l.log(LevelError, time.Now(), err.Error(), propertyFields(properties))
 }
 
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
-	l.print(LevelFatal, err.Error(), properties)
+	l.log(LevelFatal, time.Now(), err.Error(), propertyFields(properties))
 	os.Exit(1)
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
-		return 0, nil
+func propertyFields(properties map[string]string) []Field {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
 	}
-	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
-	}{
-		Level:      level.String(),
-		Time:       time.Now().UTC().Format(time.RFC3339),
-		Message:    message,
-		Properties: properties,
+	sort.Strings(keys)
+	fields := make([]Field, len(keys))
+	for i, key := range keys {
+		fields[i] = String(key, properties[key])
 	}
-	if level >= LevelError {
-		aux.Trace = string(debug.Stack())
-	}
-	var line []byte
+	return fields
+}
 
-	line, err := json.Marshal(aux)
-	if err != nil {
-		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
+func (l *Logger) log(level Level, t time.Time, message string, fields []Field) {
+	c := l.core
+	if !l.Enabled(level) {
+		return
 	}
+	if level < LevelError && c.sampler != nil && !c.sampler.allow(level, message) {
+		return
+	}
+	var b bytes.Buffer
+	b.WriteString(`{"level":`)
+	writeString(&b, level.String())
+	b.WriteString(`,"time":`)
+	writeString(&b, t.UTC().Format(time.RFC3339))
+	b.WriteString(`,"message":`)
+	writeString(&b, message)
+	if len(l.fields)+len(fields) > 0 {
+		b.WriteString(`,"properties":`)
+		c.writeObject(&b, append(l.fields[:len(l.fields):len(l.fields)], fields...))
+	}
+	if level >= c.stackLevel {
+		b.WriteString(`,"trace":`)
+		writeString(&b, string(debug.Stack()))
+	}
+	b.WriteString("}\n")
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.out.Write(append(line, '\n'))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sink := range c.sinks {
+		if level >= sink.MinLevel {
+			sink.Writer.Write(b.Bytes())
+		}
+	}
 }
 
+// Write logs message as an error, so that a Logger can be used as the output
+// of a standard library log.Logger.
 func (l *Logger) Write(message []byte) (n int, err error) {
-	return l.print(LevelError, string(message), nil)
+	l.log(LevelError, time.Now(), strings.TrimSuffix(string(message), "\n"), nil)
+	return len(message), nil
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	enc, _ := json.Marshal(s)
+	b.Write(enc)
 }
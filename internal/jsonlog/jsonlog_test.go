@@ -0,0 +1,41 @@
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStackLevel(t *testing.T) {
+	debug, warn := LevelDebug, LevelWarn
+	tests := []struct {
+		name       string
+		stackLevel *Level
+		want       map[Level]bool
+	}{
+		{"default", nil, map[Level]bool{LevelDebug: false, LevelError: false, LevelFatal: true}},
+		{"debug", &debug, map[Level]bool{LevelDebug: true, LevelInfo: true, LevelError: true}},
+		{"warn", &warn, map[Level]bool{LevelInfo: false, LevelWarn: true, LevelError: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := NewWithConfig(Config{Level: LevelDebug, Sinks: []Sink{{Writer: &buf}}, StackLevel: tt.stackLevel})
+			for level, want := range tt.want {
+				buf.Reset()
+				l.log(level, time.Now(), "entry", nil)
+				var entry map[string]any
+				err := json.Unmarshal(buf.Bytes(), &entry)
+				if err != nil {
+					t.Fatalf("%s: decoding %q: %v", level, buf.String(), err)
+				}
+				trace, _ := entry["trace"].(string)
+				if got := strings.Contains(trace, "goroutine"); got != want {
+					t.Errorf("%s: got a stack trace %v, want %v", level, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package jsonlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is a log file that is renamed to path.1 once it would grow
+// past maxSize bytes, shifting older files to path.2 and so on and deleting
+// those past maxBackups.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending, creating it and its directory if
+// needed.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	err = f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// An entry larger than maxSize still gets a file of its own.
+	var rotateErr error
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+	}
+	// If rotating failed, the entry still goes to the current file, and
+	// rotating is tried again on the next write.
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate renames the files while the current one is still open, so that it
+// can be written to until the new one has been opened.
+func (f *RotatingFile) rotate() error {
+	var err error
+	if f.maxBackups > 0 {
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err = os.Rename(f.path, f.path+".1")
+	} else {
+		err = os.Remove(f.path)
+	}
+	if err != nil {
+		return err
+	}
+	old := f.file
+	err = f.open()
+	if err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
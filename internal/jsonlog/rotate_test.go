@@ -0,0 +1,86 @@
+package jsonlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "api.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, entry := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		_, err := f.Write([]byte(entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{path: "four\nfive\n", path + ".1": "three\n", path + ".2": "one\ntwo\n"} {
+		if got := readFile(t, name); got != want {
+			t.Errorf("%s holds %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("got %v for a third backup, want it not to exist", err)
+	}
+}
+
+// TestRotatingFileRenameFails checks that entries keep being written when the
+// file cannot be rotated, and that rotating resumes once it can.
+func TestRotatingFileRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.log")
+	f, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.Write([]byte("one\ntwo\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A non-empty directory in the way of the backup stops the rename.
+	err = os.MkdirAll(filepath.Join(path+".1", "blocker"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.Write([]byte("three\n"))
+	if err == nil || n != len("three\n") {
+		t.Fatalf("got %d, %v, want the entry written and the rotation error", n, err)
+	}
+	_, err = f.Write([]byte("four\n"))
+	if err == nil {
+		t.Fatal("got no error while the backup is still blocked")
+	}
+	if got := readFile(t, path); got != "one\ntwo\nthree\nfour\n" {
+		t.Fatalf("log holds %q, want every entry", got)
+	}
+
+	err = os.RemoveAll(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("five\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "five\n" {
+		t.Errorf("log holds %q after rotating, want %q", got, "five\n")
+	}
+	if got := readFile(t, path+".1"); !strings.HasSuffix(got, "four\n") {
+		t.Errorf("backup holds %q, want the earlier entries", got)
+	}
+}
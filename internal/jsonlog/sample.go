@@ -0,0 +1,53 @@
+package jsonlog
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampling keeps the first First entries with the same level and message in
+// each Interval, and then every Thereafter-th one. With Thereafter zero the
+// rest of the interval's entries are dropped.
+type Sampling struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+type sampler struct {
+	cfg Sampling
+
+	mu     sync.Mutex
+	reset  time.Time
+	counts map[sampleKey]int
+}
+
+type sampleKey struct {
+	level   Level
+	message string
+}
+
+func newSampler(cfg Sampling) *sampler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	return &sampler{cfg: cfg, counts: make(map[sampleKey]int)}
+}
+
+func (s *sampler) allow(level Level, message string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.After(s.reset) {
+		// Starting afresh also bounds the map by the messages of one interval.
+		clear(s.counts)
+		s.reset = now.Add(s.cfg.Interval)
+	}
+	key := sampleKey{level, message}
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.cfg.First {
+		return true
+	}
+	return s.cfg.Thereafter > 0 && (n-s.cfg.First)%s.cfg.Thereafter == 0
+}
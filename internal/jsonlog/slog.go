@@ -0,0 +1,124 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Handler returns a log/slog handler that writes through l, so code written
+// against slog shares l's sinks, level, sampling and redaction. slog levels
+// map to the nearest level at or below them; groups become nested objects.
+func (l *Logger) Handler() slog.Handler {
+	return &slogHandler{logger: l, frames: []frame{{}}}
+}
+
+type slogHandler struct {
+	logger *Logger
+	// frames[0] holds attributes outside any group; each later frame is a
+	// group opened with WithGroup.
+	frames []frame
+}
+
+type frame struct {
+	group  string
+	fields []Field
+}
+
+func levelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(levelFromSlog(level))
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	var fields []Field
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, a)
+		return true
+	})
+	// Close the open groups from the innermost out. Empty groups are left
+	// out, as slog's own handlers do.
+	for i := len(h.frames) - 1; i > 0; i-- {
+		fields = append(h.frames[i].fields[:len(h.frames[i].fields):len(h.frames[i].fields)], fields...)
+		if len(fields) > 0 {
+			fields = []Field{Object(h.frames[i].group, fields...)}
+		}
+	}
+	fields = append(h.frames[0].fields[:len(h.frames[0].fields):len(h.frames[0].fields)], fields...)
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	h.logger.log(levelFromSlog(r.Level), t, r.Message, fields)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	frames := append([]frame(nil), h.frames...)
+	last := &frames[len(frames)-1]
+	fields := last.fields[:len(last.fields):len(last.fields)]
+	for _, a := range attrs {
+		fields = appendAttr(fields, a)
+	}
+	last.fields = fields
+	return &slogHandler{logger: h.logger, frames: frames}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	frames := append(h.frames[:len(h.frames):len(h.frames)], frame{group: name})
+	return &slogHandler{logger: h.logger, frames: frames}
+}
+
+func appendAttr(fields []Field, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindGroup:
+		var group []Field
+		for _, ga := range v.Group() {
+			group = appendAttr(group, ga)
+		}
+		if len(group) == 0 {
+			return fields
+		}
+		// A group without a key is inlined.
+		if a.Key == "" {
+			return append(fields, group...)
+		}
+		return append(fields, Object(a.Key, group...))
+	case slog.KindString:
+		return append(fields, String(a.Key, v.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(a.Key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, Any(a.Key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(a.Key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(a.Key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, Duration(a.Key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(a.Key, v.Time()))
+	default:
+		return append(fields, Any(a.Key, v.Any()))
+	}
+}
@@ -0,0 +1,192 @@
+// Package jwt signs and verifies JSON Web Tokens with Ed25519, the EdDSA
+// algorithm of RFC 8037. Every key has an ID that is written to the kid
+// header, so keys can be rotated: new tokens are signed with the current key
+// and each token is verified with the key it names, for as long as that key
+// is kept in the set.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// leeway is the clock skew tolerated between the instances that sign and
+// verify a token.
+const leeway = 30 * time.Second
+
+var (
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	ErrExpiredToken = errors.New("jwt: token has expired")
+)
+
+// RegisteredClaims are the standard claims checked by Verify. Embed it in a
+// struct to add private claims.
+type RegisteredClaims struct {
+	Issuer   string `json:"iss"`
+	Subject  string `json:"sub"`
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+	ID       string `json:"jti,omitempty"`
+}
+
+func (c *RegisteredClaims) registered() *RegisteredClaims {
+	return c
+}
+
+type claims interface {
+	registered() *RegisteredClaims
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid"`
+}
+
+// KeySet holds the public keys tokens are verified with, and the private key
+// new tokens are signed with.
+type KeySet struct {
+	signingKID string
+	signingKey ed25519.PrivateKey
+	keys       map[string]ed25519.PublicKey
+}
+
+// LoadDir reads every <kid>.pem file in dir. Each holds either a PKCS #8
+// private key, as written by
+//
+//	openssl genpkey -algorithm ed25519 -out <kid>.pem
+//
+// or the PKIX public key of a retired key that is only kept to verify tokens
+// signed before the rotation, as written by
+//
+//	openssl pkey -in old.pem -pubout -out <kid>.pem
+//
+// New tokens are signed with the private key named signingKID or, if that is
+// empty, the private key whose ID sorts last, so date-based IDs such as
+// 2024-06 rotate to the newest key.
+func LoadDir(dir, signingKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	ks := &KeySet{keys: make(map[string]ed25519.PublicKey)}
+	private := make(map[string]ed25519.PrivateKey)
+	var lastKID string
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("jwt: %s: no PEM data", path)
+		}
+		var key any
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		default:
+			err = fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %s: %w", path, err)
+		}
+		switch key := key.(type) {
+		case ed25519.PrivateKey:
+			ks.keys[kid] = key.Public().(ed25519.PublicKey)
+			private[kid] = key
+			lastKID = kid
+		case ed25519.PublicKey:
+			ks.keys[kid] = key
+		default:
+			return nil, fmt.Errorf("jwt: %s: not an Ed25519 key", path)
+		}
+	}
+	if signingKID == "" {
+		signingKID = lastKID
+	}
+	key, ok := private[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("jwt: no private key %q in %s", signingKID, dir)
+	}
+	ks.signingKID, ks.signingKey = signingKID, key
+	return ks, nil
+}
+
+// Sign returns c as a token signed with the signing key.
+func (ks *KeySet) Sign(c claims) (string, error) {
+	if ks.signingKey == nil {
+		return "", errors.New("jwt: no signing key")
+	}
+	h, err := json.Marshal(header{Alg: "EdDSA", Typ: "JWT", Kid: ks.signingKID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(ks.signingKey, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks the token's signature, expiry and issuer and decodes its
+// claims into c.
+func (ks *KeySet) Verify(token, issuer string, c claims) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return ErrInvalidToken
+	}
+	// Only EdDSA is accepted, whatever the header asks for, which rules out
+	// "none" and algorithm confusion.
+	if h.Alg != "EdDSA" {
+		return ErrInvalidToken
+	}
+	key, ok := ks.keys[h.Kid]
+	if !ok {
+		return ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !ed25519.Verify(key, []byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalidToken
+	}
+	if err := decodeSegment(parts[1], c); err != nil {
+		return ErrInvalidToken
+	}
+	rc := c.registered()
+	now := time.Now()
+	if rc.Issuer != issuer || rc.IssuedAt > now.Add(leeway).Unix() {
+		return ErrInvalidToken
+	}
+	if now.Add(-leeway).Unix() >= rc.Expiry {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+func decodeSegment(segment string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
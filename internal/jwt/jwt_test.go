@@ -0,0 +1,231 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://api.example.com"
+
+type testClaims struct {
+	RegisteredClaims
+	Scope string `json:"scope"`
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writeKey writes key to dir as <kid>.pem: the private key, or only its
+// public half if public is set.
+func writeKey(t *testing.T, dir, kid string, key ed25519.PrivateKey, public bool) {
+	t.Helper()
+	var block *pem.Block
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadDir(t *testing.T, dir, signingKID string) *KeySet {
+	t.Helper()
+	ks, err := LoadDir(dir, signingKID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+// encode builds a token from h and c, with sign computing the signature over
+// the signing input.
+func encode(t *testing.T, h header, c any, sign func(signingInput []byte) []byte) string {
+	t.Helper()
+	hb, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func claimsAt(now time.Time, iat, exp time.Duration) testClaims {
+	return testClaims{
+		RegisteredClaims: RegisteredClaims{
+			Issuer:   testIssuer,
+			Subject:  "42",
+			IssuedAt: now.Add(iat).Unix(),
+			Expiry:   now.Add(exp).Unix(),
+		},
+		Scope: "replays:read",
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	key := newKey(t)
+	writeKey(t, dir, "2024-01", key, false)
+	ks := loadDir(t, dir, "")
+	other := newKey(t)
+
+	now := time.Now()
+	valid := claimsAt(now, 0, 15*time.Minute)
+	edDSA := func(key ed25519.PrivateKey) func([]byte) []byte {
+		return func(signingInput []byte) []byte { return ed25519.Sign(key, signingInput) }
+	}
+	good := header{Alg: "EdDSA", Typ: "JWT", Kid: "2024-01"}
+
+	tests := []struct {
+		name   string
+		token  string
+		issuer string
+		want   error
+	}{
+		{"valid", encode(t, good, valid, edDSA(key)), testIssuer, nil},
+		{"alg none", encode(t, header{Alg: "none", Kid: "2024-01"}, valid, func([]byte) []byte { return nil }), testIssuer, ErrInvalidToken},
+		{"alg none with a signature", encode(t, header{Alg: "none", Kid: "2024-01"}, valid, edDSA(key)), testIssuer, ErrInvalidToken},
+		{"alg HS256 keyed with the public key", encode(t, header{Alg: "HS256", Kid: "2024-01"}, valid, func(signingInput []byte) []byte {
+			mac := hmac.New(sha256.New, key.Public().(ed25519.PublicKey))
+			mac.Write(signingInput)
+			return mac.Sum(nil)
+		}), testIssuer, ErrInvalidToken},
+		{"unknown kid", encode(t, header{Alg: "EdDSA", Kid: "2023-01"}, valid, edDSA(key)), testIssuer, ErrInvalidToken},
+		{"no kid", encode(t, header{Alg: "EdDSA"}, valid, edDSA(key)), testIssuer, ErrInvalidToken},
+		{"signed with another key", encode(t, good, valid, edDSA(other)), testIssuer, ErrInvalidToken},
+		{"truncated signature", encode(t, good, valid, func(signingInput []byte) []byte { return ed25519.Sign(key, signingInput)[:32] }), testIssuer, ErrInvalidToken},
+		{"two segments", "eyJhbGciOiJFZERTQSJ9.e30", testIssuer, ErrInvalidToken},
+		{"issuer mismatch", encode(t, good, valid, edDSA(key)), "https://evil.example.com", ErrInvalidToken},
+		{"expired within leeway", encode(t, good, claimsAt(now, -time.Hour, -leeway/2), edDSA(key)), testIssuer, nil},
+		{"expired beyond leeway", encode(t, good, claimsAt(now, -time.Hour, -leeway-5*time.Second), edDSA(key)), testIssuer, ErrExpiredToken},
+		{"issued ahead within leeway", encode(t, good, claimsAt(now, leeway/2, time.Hour), edDSA(key)), testIssuer, nil},
+		{"issued ahead beyond leeway", encode(t, good, claimsAt(now, leeway+time.Minute, time.Hour), edDSA(key)), testIssuer, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c testClaims
+			err := ks.Verify(tt.token, tt.issuer, &c)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && (c.Subject != "42" || c.Scope != "replays:read") {
+				t.Errorf("decoded %+v", c)
+			}
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01", newKey(t), false)
+	ks := loadDir(t, dir, "")
+	token, err := ks.Sign(&testClaims{
+		RegisteredClaims: RegisteredClaims{Issuer: testIssuer, Subject: "7", IssuedAt: time.Now().Unix(), Expiry: time.Now().Add(time.Minute).Unix()},
+		Scope:            "admin:jobs",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c testClaims
+	err = ks.Verify(token, testIssuer, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "7" || c.Scope != "admin:jobs" {
+		t.Errorf("decoded %+v", c)
+	}
+}
+
+// TestRotation checks that once a new key takes over, tokens signed with the
+// retired one still verify for as long as its public key is kept, and stop
+// verifying once it is removed.
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := newKey(t)
+	writeKey(t, dir, "2024-01", oldKey, false)
+	before := loadDir(t, dir, "")
+	claims := &testClaims{RegisteredClaims: RegisteredClaims{Issuer: testIssuer, Subject: "42", IssuedAt: time.Now().Unix(), Expiry: time.Now().Add(time.Hour).Unix()}}
+	oldToken, err := before.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retire the old key, keeping only its public half, and add a new one.
+	writeKey(t, dir, "2024-01", oldKey, true)
+	writeKey(t, dir, "2024-06", newKey(t), false)
+	after := loadDir(t, dir, "")
+	if after.signingKID != "2024-06" {
+		t.Fatalf("signing with %q, want 2024-06", after.signingKID)
+	}
+	newToken, err := after.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		var c testClaims
+		if err := after.Verify(token, testIssuer, &c); err != nil {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+	// Tokens signed after the rotation mean nothing to instances that have
+	// not picked up the new key yet.
+	var c testClaims
+	if err := before.Verify(newToken, testIssuer, &c); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("new token on the old key set: got %v, want %v", err, ErrInvalidToken)
+	}
+
+	err = os.Remove(filepath.Join(dir, "2024-01.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned := loadDir(t, dir, "")
+	if err := pruned.Verify(oldToken, testIssuer, &c); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("old token once its key is removed: got %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01", newKey(t), false)
+	writeKey(t, dir, "2024-06", newKey(t), true)
+
+	ks := loadDir(t, dir, "2024-01")
+	if ks.signingKID != "2024-01" || len(ks.keys) != 2 {
+		t.Errorf("signing with %q and %d keys, want 2024-01 and 2", ks.signingKID, len(ks.keys))
+	}
+	// A retired key, kept only as a public key, cannot sign.
+	if _, err := LoadDir(dir, "2024-06"); err == nil {
+		t.Error("got no error for signing with a public key")
+	}
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File writes every message to its own .eml file in a directory, where it can
+// be opened with any mail client.
+type File struct {
+	renderer *Renderer
+	dir      string
+}
+
+func NewFile(renderer *Renderer, dir string) (*File, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		renderer: renderer,
+		dir:      dir,
+	}, nil
+}
+
+func (m *File) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.renderer.Render(recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s-%s.eml",
+		msg.Date.UTC().Format("20060102T150405.000000000"),
+		strings.TrimSuffix(templateFile, filepath.Ext(templateFile)),
+		sanitizeFilename(recipient),
+	)
+	f, err := os.Create(filepath.Join(m.dir, name))
+	if err != nil {
+		return err
+	}
+	_, err = msg.WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Check makes sure a message could still be written to the directory.
+func (m *File) Check(_ context.Context) error {
+	f, err := os.CreateTemp(m.dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -1,61 +1,143 @@
 package mailer
 
 import (
+	"DotaReplays/internal/i18n"
 	"bytes"
+	"context"
 	"embed"
 	"github.com/go-mail/mail/v2"
+	"html"
 	"html/template"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
 	"time"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+// Mailer renders a template and hands the result to a delivery backend. The
+// backend is chosen at startup, so local development does not need a real
+// SMTP server.
+type Mailer interface {
+	Send(recipient, locale, templateFile string, data any) error
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
+// Checker is implemented by backends that depend on something outside the
+// process, so that a readiness check can tell whether mail can be delivered.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type Message struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Template  string    `json:"template"`
+	Subject   string    `json:"subject"`
+	PlainBody string    `json:"plain_body"`
+	HTMLBody  string    `json:"html_body"`
+	Date      time.Time `json:"date"`
+}
+
+// Renderer turns a template into a Message. Every email is the shared layout
+// in templates/layout.tmpl wrapped around the "body" of a localised template,
+// with the partials in templates/partials.tmpl available to both. A template
+// only needs to define "subject" and "body"; the plain-text part is generated
+// from the HTML unless the template defines its own "plainBody".
+type Renderer struct {
+	Sender  string
+	Brand   string
+	BaseURL string
+}
+
+func (r *Renderer) funcs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"brand":  func() string { return r.Brand },
+		"locale": func() string { return locale },
+		"url": func(path string) string {
+			return strings.TrimRight(r.BaseURL, "/") + path
+		},
+		"t": func(code string, args ...any) string {
+			return i18n.Translate(locale, code, args...)
+		},
 	}
 }
 
-func (m Mailer) Send(recipient, templateFile string, data any) error {
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+// Render builds the message for templateFile in the recipient's locale,
+// falling back to the default locale when there is no translation.
+func (r *Renderer) Render(recipient, locale, templateFile string, data any) (*Message, error) {
+	if _, err := fs.Stat(templateFS, "templates/"+locale+"/"+templateFile); err != nil {
+		locale = i18n.DefaultLocale
+	}
+	tmpl, err := template.New("email").Funcs(r.funcs(locale)).ParseFS(templateFS,
+		"templates/layout.tmpl",
+		"templates/partials.tmpl",
+		"templates/"+locale+"/"+templateFile,
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	subject := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	plainBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	htmlBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(htmlBody, "layout", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	htmlBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	var plainBody string
+	if tmpl.Lookup("plainBody") != nil {
+		buf := new(bytes.Buffer)
+		err = tmpl.ExecuteTemplate(buf, "plainBody", data)
+		if err != nil {
+			return nil, err
+		}
+		plainBody = buf.String()
+	} else {
+		plainBody = HTMLToText(htmlBody.String())
+	}
+	return &Message{
+		From:     r.Sender,
+		To:       recipient,
+		Template: templateFile,
+		// The subject is rendered in an HTML context, so undo the escaping.
+		Subject:   html.UnescapeString(strings.TrimSpace(subject.String())),
+		PlainBody: plainBody,
+		HTMLBody:  htmlBody.String(),
+		Date:      time.Now(),
+	}, nil
+}
+
+// Templates lists the names of the available email templates.
+func Templates() []string {
+	entries, err := fs.ReadDir(templateFS, "templates/"+i18n.DefaultLocale)
 	if err != nil {
-		return err
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
 	}
+	sort.Strings(names)
+	return names
+}
 
+func (m *Message) mime() *mail.Message {
 	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	msg.SetHeader("To", m.To)
+	msg.SetHeader("From", m.From)
+	msg.SetHeader("Subject", m.Subject)
+	msg.SetDateHeader("Date", m.Date)
+	msg.SetBody("text/plain", m.PlainBody)
+	msg.AddAlternative("text/html", m.HTMLBody)
+	return msg
+}
 
-	err = m.dialer.DialAndSend(msg)
-	if err != nil {
-		return err
-	}
-	return nil
+// WriteTo writes the message in RFC 5322 format, as it would go over the wire.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	return m.mime().WriteTo(w)
 }
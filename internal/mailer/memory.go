@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"sync"
+)
+
+// Memory keeps rendered messages in memory so that tests can assert on what
+// would have been sent.
+type Memory struct {
+	mu       sync.Mutex
+	renderer *Renderer
+	messages []Message
+}
+
+func NewMemory(renderer *Renderer) *Memory {
+	return &Memory{renderer: renderer}
+}
+
+func (m *Memory) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.renderer.Render(recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of every message captured so far, oldest first.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// SentTo returns the messages captured for recipient, oldest first.
+func (m *Memory) SentTo(recipient string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []Message
+	for _, msg := range m.messages {
+		if msg.To == recipient {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
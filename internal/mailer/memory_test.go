@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+var testRenderer = &Renderer{Sender: "DotaReplays <no-reply@example.com>", Brand: "DotaReplays", BaseURL: "http://localhost:4000"}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(testRenderer)
+	err := m.Send("alice@example.com", "en", "user_welcome.tmpl", map[string]any{
+		"activationToken": "ALICETOKENALICETOKENALICET",
+		"userID":          1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A locale without translations falls back to the default one.
+	err = m.Send("bob@example.com", "xx", "token_activation.tmpl", map[string]any{
+		"activationToken": "BOBTOKENBOBTOKENBOBTOKENBO",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := m.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+	for i, want := range []struct {
+		to, template, token string
+	}{
+		{"alice@example.com", "user_welcome.tmpl", "ALICETOKENALICETOKENALICET"},
+		{"bob@example.com", "token_activation.tmpl", "BOBTOKENBOBTOKENBOBTOKENBO"},
+	} {
+		msg := messages[i]
+		if msg.From != "DotaReplays <no-reply@example.com>" {
+			t.Errorf("message %d is from %q", i, msg.From)
+		}
+		if msg.To != want.to || msg.Template != want.template {
+			t.Errorf("message %d went to %q from %q, want %q from %q", i, msg.To, msg.Template, want.to, want.template)
+		}
+		if msg.Subject == "" {
+			t.Errorf("message %d has no subject", i)
+		}
+		if !strings.Contains(msg.PlainBody, want.token) || !strings.Contains(msg.HTMLBody, want.token) {
+			t.Errorf("message %d does not carry its token %s", i, want.token)
+		}
+	}
+
+	sent := m.SentTo("bob@example.com")
+	if len(sent) != 1 || sent[0].Template != "token_activation.tmpl" {
+		t.Errorf("SentTo(bob) = %+v, want the activation message", sent)
+	}
+	if sent := m.SentTo("carol@example.com"); len(sent) != 0 {
+		t.Errorf("SentTo(carol) = %+v, want nothing", sent)
+	}
+
+	// Messages returns a copy that callers cannot change.
+	messages[0].To = "mallory@example.com"
+	if m.Messages()[0].To != "alice@example.com" {
+		t.Error("changing the result of Messages changed what was captured")
+	}
+
+	m.Reset()
+	if n := len(m.Messages()); n != 0 {
+		t.Errorf("got %d messages after Reset, want 0", n)
+	}
+}
+
+func TestMemoryUnknownTemplate(t *testing.T) {
+	m := NewMemory(testRenderer)
+	err := m.Send("alice@example.com", "en", "no_such_template.tmpl", nil)
+	if err == nil {
+		t.Fatal("got no error for an unknown template")
+	}
+	if n := len(m.Messages()); n != 0 {
+		t.Errorf("captured %d messages, want 0", n)
+	}
+}
@@ -0,0 +1,38 @@
+package mailer
+
+// samples holds made-up data for every template, used to preview emails
+// without going through the flow that normally sends them.
+var samples = map[string]map[string]any{
+	"user_welcome.tmpl": {
+		"userID":          42,
+		"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+	},
+	"token_activation.tmpl": {
+		"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+	},
+	"password_reset.tmpl": {
+		"passwordResetToken": "P4B3XJMNQ2CGZTXU7RFD6WLKEA",
+	},
+	"email_change_confirm.tmpl": {
+		"newEmail": "new.address@example.com",
+		"token":    "C7GH2KQWLTZN4YB5RDXJ3MPVAE",
+	},
+	"email_change_notice.tmpl": {
+		"newEmail":    "new.address@example.com",
+		"cancelToken": "N5QKZ2WTJ7XB4MLRCGH3YDPVUF",
+	},
+	"account_lockout.tmpl": {
+		"ipAddress":   "203.0.113.7",
+		"lockedUntil": "2024-01-01 12:30 UTC",
+	},
+	"new_login.tmpl": {
+		"time":      "2024-01-01 12:00 UTC",
+		"ipAddress": "203.0.113.7",
+		"userAgent": "Mozilla/5.0 (X11; Linux x86_64) Firefox/121.0",
+	},
+}
+
+// SampleData returns preview data for templateFile, or nil if there is none.
+func SampleData(templateFile string) map[string]any {
+	return samples[templateFile]
+}
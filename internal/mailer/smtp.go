@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+	"github.com/go-mail/mail/v2"
+	"net"
+	"strconv"
+	"time"
+)
+
+type SMTP struct {
+	renderer *Renderer
+	dialer   *mail.Dialer
+}
+
+func NewSMTP(renderer *Renderer, host string, port int, username, password string) *SMTP {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+	return &SMTP{
+		renderer: renderer,
+		dialer:   dialer,
+	}
+}
+
+func (m *SMTP) Send(recipient, locale, templateFile string, data any) error {
+	msg, err := m.renderer.Render(recipient, locale, templateFile, data)
+	if err != nil {
+		return err
+	}
+	return m.dialer.DialAndSend(msg.mime())
+}
+
+// Check connects to the SMTP server without logging in or sending anything,
+// which is enough to tell that it is reachable.
+func (m *SMTP) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(m.dialer.Host, strconv.Itoa(m.dialer.Port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	hrefRX       = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	blankLinesRX = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText produces the plain-text alternative of an HTML email: block
+// elements become paragraphs, list items become dashes, links are followed by
+// their URL and <pre> blocks keep their layout. It only needs to cope with
+// the markup in our own templates, not arbitrary HTML.
+func HTMLToText(s string) string {
+	var (
+		b        strings.Builder
+		skip     int
+		pre      int
+		hrefs    []string
+		linkText strings.Builder
+	)
+	write := func(text string) {
+		b.WriteString(text)
+		if len(hrefs) > 0 {
+			linkText.WriteString(text)
+		}
+	}
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt != 0 {
+			if lt < 0 {
+				lt = len(s)
+			}
+			text := html.UnescapeString(s[:lt])
+			s = s[lt:]
+			if skip > 0 {
+				continue
+			}
+			if pre == 0 {
+				text = strings.Join(strings.Fields(text), " ")
+				if text == "" {
+					continue
+				}
+				if out := b.String(); len(out) > 0 && !strings.HasSuffix(out, "\n") && !strings.HasSuffix(out, " ") {
+					write(" ")
+				}
+			}
+			write(text)
+			continue
+		}
+		gt := strings.IndexByte(s, '>')
+		if gt < 0 {
+			break
+		}
+		tag := s[1:gt]
+		s = s[gt+1:]
+		if strings.HasPrefix(tag, "!") {
+			continue
+		}
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.TrimLeft(tag, "/"))
+		if i := strings.IndexAny(name, " \t\n/"); i >= 0 {
+			name = name[:i]
+		}
+		switch name {
+		case "head", "style", "script", "title":
+			if closing {
+				skip--
+			} else {
+				skip++
+			}
+		case "br":
+			write("\n")
+		case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "tr", "ul", "ol":
+			write("\n\n")
+		case "hr":
+			write("\n\n---\n\n")
+		case "li":
+			if !closing {
+				write("\n- ")
+			}
+		case "pre":
+			write("\n\n")
+			if closing {
+				pre--
+			} else {
+				pre++
+			}
+		case "a":
+			if !closing {
+				href := ""
+				if m := hrefRX.FindStringSubmatch(tag); m != nil {
+					href = html.UnescapeString(m[1] + m[2])
+				}
+				hrefs = append(hrefs, href)
+				linkText.Reset()
+				continue
+			}
+			if len(hrefs) == 0 {
+				continue
+			}
+			href := hrefs[len(hrefs)-1]
+			hrefs = hrefs[:len(hrefs)-1]
+			if href != "" && strings.TrimSpace(linkText.String()) != href {
+				write(" (" + href + ")")
+			}
+		}
+	}
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	out := strings.Join(lines, "\n")
+	out = blankLinesRX.ReplaceAllString(out, "\n\n")
+	return strings.TrimSpace(out) + "\n"
+}
@@ -0,0 +1,351 @@
+// Package metrics implements counters, gauges and histograms, optionally split
+// by labels, and serves them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds suited to HTTP request
+// latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and writes them out in name order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w *bufio.Writer, name string)
+}
+
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds m under name. Registering the same name twice is a
+// programming error and panics.
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.metrics[name]; exists {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// Handler serves every metric in the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		r.mu.Lock()
+		names := make([]string, 0, len(r.metrics))
+		for name := range r.metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r.metrics[name].write(bw, name)
+		}
+		r.mu.Unlock()
+		bw.Flush()
+	})
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter by v, which must not be negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter decreased")
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Inc() {
+	addFloat(&g.bits, 1)
+}
+
+func (g *Gauge) Dec() {
+	addFloat(&g.bits, -1)
+}
+
+func (g *Gauge) value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64
+	sum         atomic.Uint64
+	count       atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		upperBounds: buckets,
+		counts:      make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	addFloat(&h.sum, v)
+	h.count.Add(1)
+}
+
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// vec holds one child metric per combination of label values.
+type vec[T any] struct {
+	desc
+	newChild func() *T
+	mu       sync.RWMutex
+	children map[string]*child[T]
+}
+
+type child[T any] struct {
+	values []string
+	metric *T
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c.metric
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.children[key]; ok {
+		return c.metric
+	}
+	c = &child[T]{values: append([]string(nil), values...), metric: v.newChild()}
+	v.children[key] = c
+	return c.metric
+}
+
+// each calls fn for every child in label value order.
+func (v *vec[T]) each(fn func(labels string, m *T)) {
+	v.mu.RLock()
+	children := make([]*child[T], 0, len(v.children))
+	for _, c := range v.children {
+		children = append(children, c)
+	}
+	v.mu.RUnlock()
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Join(children[i].values, "\xff") < strings.Join(children[j].values, "\xff")
+	})
+	for _, c := range children {
+		fn(formatLabels(v.labels, c.values), c.metric)
+	}
+}
+
+type CounterVec struct {
+	vec[Counter]
+}
+
+// NewCounterVec registers a counter split by labels. With no labels it has a
+// single child, returned by With().
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec[Counter]{
+		desc:     desc{name: name, help: help, typ: "counter", labels: labels},
+		newChild: func() *Counter { return &Counter{} },
+		children: make(map[string]*child[Counter]),
+	}}
+	r.register(name, v)
+	return v
+}
+
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values)
+}
+
+func (v *CounterVec) write(w *bufio.Writer, name string) {
+	writeHeader(w, v.desc)
+	v.each(func(labels string, c *Counter) {
+		writeSample(w, name, labels, c.value())
+	})
+}
+
+type GaugeVec struct {
+	vec[Gauge]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec[Gauge]{
+		desc:     desc{name: name, help: help, typ: "gauge", labels: labels},
+		newChild: func() *Gauge { return &Gauge{} },
+		children: make(map[string]*child[Gauge]),
+	}}
+	r.register(name, v)
+	return v
+}
+
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer, name string) {
+	writeHeader(w, v.desc)
+	v.each(func(labels string, g *Gauge) {
+		writeSample(w, name, labels, g.value())
+	})
+}
+
+type HistogramVec struct {
+	vec[Histogram]
+}
+
+// NewHistogramVec registers a histogram split by labels. buckets are the
+// sorted upper bounds; a +Inf bucket is always added.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{vec[Histogram]{
+		desc:     desc{name: name, help: help, typ: "histogram", labels: labels},
+		newChild: func() *Histogram { return newHistogram(buckets) },
+		children: make(map[string]*child[Histogram]),
+	}}
+	r.register(name, v)
+	return v
+}
+
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer, name string) {
+	writeHeader(w, v.desc)
+	v.each(func(labels string, h *Histogram) {
+		// Read the count first, so that no bucket can exceed it.
+		count := h.count.Load()
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			cumulative += h.counts[i].Load()
+			if cumulative > count {
+				cumulative = count
+			}
+			writeSample(w, name+"_bucket", joinLabels(labels, `le="`+formatFloat(bound)+`"`), float64(cumulative))
+		}
+		writeSample(w, name+"_bucket", joinLabels(labels, `le="+Inf"`), float64(count))
+		writeSample(w, name+"_sum", labels, math.Float64frombits(h.sum.Load()))
+		writeSample(w, name+"_count", labels, float64(count))
+	})
+}
+
+// funcMetric reads its value when the registry is written, for values that
+// are kept elsewhere such as sql.DB pool statistics.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is fn's result.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc{name: name, help: help, typ: "gauge"}, fn})
+}
+
+// NewCounterFunc registers a counter whose value is fn's result, which must
+// never go down.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc{name: name, help: help, typ: "counter"}, fn})
+}
+
+func (m *funcMetric) write(w *bufio.Writer, name string) {
+	writeHeader(w, m.desc)
+	writeSample(w, name, "", m.fn())
+}
+
+func writeHeader(w *bufio.Writer, d desc) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.typ)
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = names[i] + `="` + labelValueEscaper.Replace(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,327 @@
+// Package migrate applies numbered SQL migrations to PostgreSQL. Migrations are
+// files named NNNNNN_name.up.sql and NNNNNN_name.down.sql. Each runs in its own
+// transaction and is recorded in the schema_versions table, and a session-level
+// advisory lock keeps two instances from migrating at the same time.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey identifies the advisory lock. Any constant works as long as
+// nothing else in the database uses it.
+const lockKey int64 = 0x44524d4947524154
+
+var ErrUnknownVersion = errors.New("migrate: unknown version")
+
+var fileRX = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Step is a migration that was applied or, if Reverted, reverted.
+type Step struct {
+	Migration
+	Reverted bool
+}
+
+// Status is a migration and whether it has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New reads the migrations in the root of fsys. Every version needs an up
+// file; a missing down file makes that migration irreversible.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := fileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrate: %s: bad version", entry.Name())
+		}
+		b, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate: version %d has two names, %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+	mr := &Migrator{db: db}
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", mig.Version)
+		}
+		mr.migrations = append(mr.migrations, *mig)
+	}
+	sort.Slice(mr.migrations, func(i, j int) bool {
+		return mr.migrations[i].Version < mr.migrations[j].Version
+	})
+	return mr, nil
+}
+
+// Latest returns the highest known version, or 0 if there are no migrations.
+func (mr *Migrator) Latest() int64 {
+	if len(mr.migrations) == 0 {
+		return 0
+	}
+	return mr.migrations[len(mr.migrations)-1].Version
+}
+
+// Up applies every pending migration and returns the steps it took.
+func (mr *Migrator) Up(ctx context.Context) ([]Step, error) {
+	return mr.To(ctx, mr.Latest())
+}
+
+// Down reverts the last steps applied migrations and returns the steps it took.
+func (mr *Migrator) Down(ctx context.Context, steps int) ([]Step, error) {
+	var done []Step
+	err := mr.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(mr.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := mr.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			err := mr.run(ctx, conn, mig, false)
+			if err != nil {
+				return err
+			}
+			done = append(done, Step{Migration: mig, Reverted: true})
+		}
+		return nil
+	})
+	return done, err
+}
+
+// To migrates up or down so that exactly the migrations up to and including
+// version are applied, and returns the steps it took in order. Version 0
+// reverts everything.
+func (mr *Migrator) To(ctx context.Context, version int64) ([]Step, error) {
+	if version != 0 && mr.find(version) < 0 {
+		return nil, fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+	var done []Step
+	err := mr.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		// Revert newest first, then apply oldest first.
+		for i := len(mr.migrations) - 1; i >= 0; i-- {
+			mig := mr.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > version {
+				err := mr.run(ctx, conn, mig, false)
+				if err != nil {
+					return err
+				}
+				done = append(done, Step{Migration: mig, Reverted: true})
+			}
+		}
+		for _, mig := range mr.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+				err := mr.run(ctx, conn, mig, true)
+				if err != nil {
+					return err
+				}
+				done = append(done, Step{Migration: mig})
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known migration with whether it has been applied.
+func (mr *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := mr.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range mr.migrations {
+			at, ok := applied[mig.Version]
+			statuses = append(statuses, Status{Migration: mig, Applied: ok, AppliedAt: at})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (mr *Migrator) find(version int64) int {
+	for i, mig := range mr.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// locked runs fn on a single connection holding the advisory lock, after
+// making sure the version table exists.
+func (mr *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := mr.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	if err != nil {
+		return err
+	}
+	// Unlock with a fresh context, so that a cancelled ctx does not leave
+	// the lock held on a connection that goes back to the pool.
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+	err = ensureTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_versions') IS NOT NULL`).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	// Create and adopt in one transaction, so that a failed adoption is
+	// tried again next time rather than leaving an empty table.
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `
+CREATE TABLE schema_versions (
+    version bigint PRIMARY KEY,
+    name text NOT NULL,
+    applied_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+)`)
+	if err != nil {
+		return err
+	}
+	err = adoptMigrateTool(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// adoptMigrateTool carries over the version of a database migrated by hand
+// with the migrate CLI, which keeps a single row in schema_migrations, so
+// that its migrations are not applied a second time. It only runs when
+// schema_versions is first created.
+func adoptMigrateTool(ctx context.Context, tx *sql.Tx) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return err
+	}
+	var version int64
+	var dirty bool
+	err = tx.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migrate: schema_migrations is dirty at version %d; fix the database by hand first", version)
+	}
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO schema_versions (version, name)
+SELECT v, 'adopted from schema_migrations' FROM generate_series(1, $1::bigint) AS v`, version)
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_versions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		err := rows.Scan(&version, &at)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// run applies or reverts mig and records it in one transaction, so a failed
+// migration leaves nothing half done.
+func (mr *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	script := mig.Up
+	if !up {
+		script = mig.Down
+		if script == "" {
+			return fmt.Errorf("migrate: version %d (%s) cannot be reverted", mig.Version, mig.Name)
+		}
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return fmt.Errorf("migrate: version %d (%s): %w", mig.Version, mig.Name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_versions (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_versions WHERE version = $1`, mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
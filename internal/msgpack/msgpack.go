@@ -0,0 +1,138 @@
+// Package msgpack encodes values in the MessagePack format. Values are first
+// marshalled to JSON so that struct tags and json.Marshaler implementations
+// are honoured exactly as they are for JSON responses.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+func Marshal(v any) ([]byte, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	var generic any
+	err = dec.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	err = encode(buf, generic)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			encodeInt(buf, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		encodeString(buf, v)
+	case []any:
+		encodeLength(buf, len(v), 0x90, 15, 0xdc, 0xdd)
+		for _, item := range v {
+			err := encode(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encodeLength(buf, len(v), 0x80, 15, 0xde, 0xdf)
+		for _, key := range keys {
+			encodeString(buf, key)
+			err := encode(buf, v[key])
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func encodeString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+// encodeLength writes the header for an array or map of n elements: the fix
+// form when n <= fixMax, otherwise the 16-bit or 32-bit form.
+func encodeLength(buf *bytes.Buffer, n int, fixMarker byte, fixMax int, marker16, marker32 byte) {
+	switch {
+	case n <= fixMax:
+		buf.WriteByte(fixMarker | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(marker16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(marker32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
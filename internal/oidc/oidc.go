@@ -0,0 +1,187 @@
+// Package oidc implements the relying-party side of the OpenID Connect
+// authorization code flow with PKCE: provider discovery, the authorization
+// redirect, the code exchange and verification of the returned ID token
+// against the provider's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidResponse = errors.New("oidc: invalid response from provider")
+	ErrInvalidToken    = errors.New("oidc: invalid ID token")
+)
+
+type Config struct {
+	// Issuer is the provider's issuer identifier. Its discovery document is
+	// read from Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider.
+	RedirectURL string
+	Scopes      []string
+}
+
+// Metadata is the part of the provider's discovery document that is used.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	Config
+	Client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+// New returns a provider for cfg. Nothing is fetched until the provider is
+// first used, so an unreachable provider does not stop the API from starting.
+func New(cfg Config) *Provider {
+	return &Provider{
+		Config: cfg,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Metadata returns the provider's discovery document, fetching it on first
+// use. A failed fetch is not cached.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	var md Metadata
+	err := p.getJSON(ctx, strings.TrimRight(p.Issuer, "/")+"/.well-known/openid-configuration", &md)
+	if err != nil {
+		return nil, err
+	}
+	// The issuer in the document must match the configured one exactly, or
+	// ID tokens could not be checked against it.
+	if md.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w: discovery document is for issuer %q", ErrInvalidResponse, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document is missing endpoints", ErrInvalidResponse)
+	}
+	p.metadata = &md
+	p.keys = &keySet{uri: md.JWKSURI}
+	return p.metadata, nil
+}
+
+// AuthURL returns the URL to send the user to. state and nonce are echoed
+// back in the callback and the ID token respectively, and verifier is the
+// PKCE code verifier later passed to Exchange.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	md, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := []string{"openid"}
+	for _, scope := range p.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Challenge returns the S256 PKCE code challenge for verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Exchange redeems an authorization code and returns the claims of the
+// verified ID token, which must carry nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	md, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		// client_secret_basic wants both parts form-encoded first.
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: token endpoint returned %s", ErrInvalidResponse, res.Status)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("%w: token endpoint returned %s: %s", ErrInvalidResponse, res.Status, strings.TrimSpace(body.Error+" "+body.ErrorDescription))
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint returned no ID token", ErrInvalidResponse)
+	}
+	return p.Verify(ctx, body.IDToken, nonce)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned %s", url, res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(dst)
+}
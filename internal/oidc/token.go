@@ -0,0 +1,284 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leeway is the clock skew tolerated when checking exp and iat.
+const leeway = time.Minute
+
+// keyRefreshInterval limits how often an unknown key ID makes the key set be
+// fetched again, so that tokens with made-up key IDs cannot be used to flood
+// the provider.
+const keyRefreshInterval = 30 * time.Second
+
+// Claims are the claims of a verified ID token.
+type Claims map[string]any
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// String returns the named claim if it is a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the named claim as a list. A single string is a list of one,
+// as some providers send single-valued groups that way.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Bool returns the named claim if it is true or the string "true", which some
+// providers send for email_verified.
+func (c Claims) Bool(name string) bool {
+	switch v := c[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// Verify checks the signature and standard claims of a raw ID token and
+// returns its claims. The token must be issued by the provider to this client
+// and carry nonce.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if _, err := p.Metadata(ctx); err != nil {
+		return nil, err
+	}
+	key, err := p.keys.get(ctx, p, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return nil, ErrInvalidToken
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return nil, ErrInvalidToken
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return nil, ErrInvalidToken
+		}
+	default:
+		// This includes "none", which must never be accepted.
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.String("iss") != p.Issuer || claims.Subject() == "" {
+		return nil, ErrInvalidToken
+	}
+	audience := claims.Strings("aud")
+	if !contains(audience, p.ClientID) {
+		return nil, ErrInvalidToken
+	}
+	if len(audience) > 1 && claims.String("azp") != p.ClientID {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	exp, ok := claims.time("exp")
+	if !ok || now.After(exp.Add(leeway)) {
+		return nil, fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	}
+	iat, ok := claims.time("iat")
+	if !ok || iat.After(now.Add(leeway)) {
+		return nil, ErrInvalidToken
+	}
+	if nbf, ok := claims.time("nbf"); ok && nbf.After(now.Add(leeway)) {
+		return nil, ErrInvalidToken
+	}
+	if claims.String("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// keySet caches the provider's signing keys by key ID.
+type keySet struct {
+	uri string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// get returns the key with kid, fetching the key set again if kid is unknown
+// since providers rotate their keys. An empty kid is accepted when the set
+// holds a single key.
+func (s *keySet) get(ctx context.Context, p *Provider, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(s.fetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := p.getJSON(ctx, s.uri, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	s.keys = make(map[string]crypto.PublicKey)
+	s.fetched = time.Now()
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		s.keys[k.Kid] = key
+	}
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+}
+
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// jwk is a JSON Web Key as published in a provider's key set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("oidc: bad RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("oidc: bad P-256 point")
+		}
+		// Let crypto/ecdh reject points that are not on the curve.
+		point := append([]byte{4}, append(x, y...)...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("oidc: unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,358 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "dotareplays"
+
+// testIssuer serves a discovery document and a key set that can be changed,
+// counting how often the key set is fetched.
+type testIssuer struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	ti.keys = []map[string]string{rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 ti.URL,
+			"authorization_endpoint": ti.URL + "/authorize",
+			"token_endpoint":         ti.URL + "/token",
+			"jwks_uri":               ti.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		ti.fetches++
+		json.NewEncoder(w).Encode(map[string]any{"keys": ti.keys})
+	})
+	ti.Server = httptest.NewServer(mux)
+	t.Cleanup(ti.Close)
+	return ti
+}
+
+func (ti *testIssuer) provider() *Provider {
+	p := New(Config{Issuer: ti.URL, ClientID: testClientID})
+	p.Client = ti.Client()
+	return p
+}
+
+func (ti *testIssuer) addKey(key map[string]string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.keys = append(ti.keys, key)
+}
+
+func (ti *testIssuer) fetchCount() int {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	return ti.fetches
+}
+
+// claims returns valid claims for a token issued now with nonce "n-0S6".
+func (ti *testIssuer) claims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   ti.URL,
+		"sub":   "alice",
+		"aud":   testClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": "n-0S6",
+	}
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"use": "sig",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, pub *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"use": "sig",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// signer computes the signature over a token's signing input.
+type signer func(t *testing.T, signingInput []byte) []byte
+
+func rs256(key *rsa.PrivateKey) signer {
+	return func(t *testing.T, signingInput []byte) []byte {
+		digest := sha256.Sum256(signingInput)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+}
+
+func es256(key *ecdsa.PrivateKey) signer {
+	return func(t *testing.T, signingInput []byte) []byte {
+		digest := sha256.Sum256(signingInput)
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+}
+
+// resized changes the length of the signature made by s by n bytes.
+func resized(s signer, n int) signer {
+	return func(t *testing.T, signingInput []byte) []byte {
+		sig := s(t, signingInput)
+		if n < 0 {
+			return sig[:len(sig)+n]
+		}
+		return append(sig, make([]byte, n)...)
+	}
+}
+
+func encodeToken(t *testing.T, alg, kid string, claims map[string]any, sign signer) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(t, []byte(signingInput)))
+}
+
+func TestVerify(t *testing.T) {
+	ti := newTestIssuer(t)
+	p := ti.provider()
+	rsaSig, ecSig := rs256(ti.rsaKey), es256(ti.ecKey)
+	none := func(*testing.T, []byte) []byte { return nil }
+	hs256 := func(t *testing.T, signingInput []byte) []byte {
+		// Keyed with the public key, as in the classic algorithm confusion.
+		mac := hmac.New(sha256.New, ti.rsaKey.PublicKey.N.Bytes())
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	}
+	with := func(changes map[string]any) map[string]any {
+		c := ti.claims()
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		alg    string
+		kid    string
+		claims map[string]any
+		sign   signer
+		valid  bool
+	}{
+		{"RS256", "RS256", "rsa-1", ti.claims(), rsaSig, true},
+		{"ES256", "ES256", "ec-1", ti.claims(), ecSig, true},
+		{"alg none", "none", "rsa-1", ti.claims(), none, false},
+		{"alg HS256", "HS256", "rsa-1", ti.claims(), hs256, false},
+		{"RS256 with an EC key", "RS256", "ec-1", ti.claims(), rsaSig, false},
+		{"ES256 with an RSA key", "ES256", "rsa-1", ti.claims(), ecSig, false},
+		{"RS256 signature a byte short", "RS256", "rsa-1", ti.claims(), resized(rsaSig, -1), false},
+		{"RS256 signature a byte long", "RS256", "rsa-1", ti.claims(), resized(rsaSig, 1), false},
+		{"ES256 signature a byte short", "ES256", "ec-1", ti.claims(), resized(ecSig, -1), false},
+		{"ES256 signature a byte long", "ES256", "ec-1", ti.claims(), resized(ecSig, 1), false},
+		{"ES256 signature in DER", "ES256", "ec-1", ti.claims(), func(t *testing.T, signingInput []byte) []byte {
+			digest := sha256.Sum256(signingInput)
+			sig, err := ecdsa.SignASN1(rand.Reader, ti.ecKey, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		}, false},
+		{"signed with another key", "ES256", "ec-1", ti.claims(), es256(mustECKey(t)), false},
+		{"unknown kid", "RS256", "rsa-9", ti.claims(), rsaSig, false},
+		{"issuer mismatch", "RS256", "rsa-1", with(map[string]any{"iss": "https://evil.example.com"}), rsaSig, false},
+		{"no subject", "RS256", "rsa-1", with(map[string]any{"sub": nil}), rsaSig, false},
+		{"audience of another client", "RS256", "rsa-1", with(map[string]any{"aud": "other"}), rsaSig, false},
+		{"audiences with azp", "RS256", "rsa-1", with(map[string]any{"aud": []string{"other", testClientID}, "azp": testClientID}), rsaSig, true},
+		{"audiences without azp", "RS256", "rsa-1", with(map[string]any{"aud": []string{"other", testClientID}}), rsaSig, false},
+		{"audiences with another azp", "RS256", "rsa-1", with(map[string]any{"aud": []string{testClientID, "other"}, "azp": "other"}), rsaSig, false},
+		{"audiences without this client", "RS256", "rsa-1", with(map[string]any{"aud": []string{"other", "another"}, "azp": testClientID}), rsaSig, false},
+		{"single audience in a list", "RS256", "rsa-1", with(map[string]any{"aud": []string{testClientID}}), rsaSig, true},
+		{"nonce mismatch", "RS256", "rsa-1", with(map[string]any{"nonce": "n-other"}), rsaSig, false},
+		{"no nonce", "RS256", "rsa-1", with(map[string]any{"nonce": nil}), rsaSig, false},
+		{"expired within leeway", "RS256", "rsa-1", with(map[string]any{"iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-leeway / 2).Unix()}), rsaSig, true},
+		{"expired beyond leeway", "RS256", "rsa-1", with(map[string]any{"iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-2 * leeway).Unix()}), rsaSig, false},
+		{"no expiry", "RS256", "rsa-1", with(map[string]any{"exp": nil}), rsaSig, false},
+		{"issued ahead within leeway", "RS256", "rsa-1", with(map[string]any{"iat": now.Add(leeway / 2).Unix()}), rsaSig, true},
+		{"issued ahead beyond leeway", "RS256", "rsa-1", with(map[string]any{"iat": now.Add(2 * leeway).Unix()}), rsaSig, false},
+		{"not yet valid", "RS256", "rsa-1", with(map[string]any{"nbf": now.Add(2 * leeway).Unix()}), rsaSig, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := encodeToken(t, tt.alg, tt.kid, tt.claims, tt.sign)
+			claims, err := p.Verify(context.Background(), raw, "n-0S6")
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("got %v, want a valid token", err)
+			case tt.valid && claims.Subject() != "alice":
+				t.Errorf("got subject %q, want alice", claims.Subject())
+			case !tt.valid && !errors.Is(err, ErrInvalidToken):
+				t.Errorf("got %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func mustECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// TestKeyRefresh checks that an unknown key ID makes the key set be fetched
+// again, but no more than once per keyRefreshInterval.
+func TestKeyRefresh(t *testing.T) {
+	ti := newTestIssuer(t)
+	p := ti.provider()
+	ctx := context.Background()
+
+	_, err := p.Verify(ctx, encodeToken(t, "RS256", "rsa-1", ti.claims(), rs256(ti.rsaKey)), "n-0S6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ti.fetchCount(); n != 1 {
+		t.Fatalf("fetched the key set %d times, want 1", n)
+	}
+
+	// The provider rotates in a key the cached set does not hold yet. Tokens
+	// signed with it fail until the refresh interval has passed, however many
+	// arrive.
+	rotated := mustECKey(t)
+	ti.addKey(ecJWK("ec-2", &rotated.PublicKey))
+	raw := encodeToken(t, "ES256", "ec-2", ti.claims(), es256(rotated))
+	for i := 0; i < 3; i++ {
+		_, err = p.Verify(ctx, raw, "n-0S6")
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidToken)
+		}
+	}
+	if n := ti.fetchCount(); n != 1 {
+		t.Fatalf("fetched the key set %d times within the refresh interval, want 1", n)
+	}
+
+	p.keys.mu.Lock()
+	p.keys.fetched = time.Now().Add(-keyRefreshInterval)
+	p.keys.mu.Unlock()
+	_, err = p.Verify(ctx, raw, "n-0S6")
+	if err != nil {
+		t.Fatalf("after the refresh interval: %v", err)
+	}
+	if n := ti.fetchCount(); n != 2 {
+		t.Fatalf("fetched the key set %d times, want 2", n)
+	}
+
+	// The refetch restarted the interval, and keys already held need none.
+	_, err = p.Verify(ctx, encodeToken(t, "RS256", "rsa-9", ti.claims(), rs256(ti.rsaKey)), "n-0S6")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidToken)
+	}
+	_, err = p.Verify(ctx, encodeToken(t, "RS256", "rsa-1", ti.claims(), rs256(ti.rsaKey)), "n-0S6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ti.fetchCount(); n != 2 {
+		t.Errorf("fetched the key set %d times, want 2", n)
+	}
+}
+
+func TestKeySetGet(t *testing.T) {
+	ti := newTestIssuer(t)
+	p := ti.provider()
+	ctx := context.Background()
+	if _, err := p.Metadata(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Keys for other uses, of unsupported types or off the curve are skipped.
+	offCurve := ecJWK("ec-bad", &ti.ecKey.PublicKey)
+	offCurve["y"] = offCurve["x"]
+	enc := rsaJWK("rsa-enc", &ti.rsaKey.PublicKey)
+	enc["use"] = "enc"
+	ti.addKey(offCurve)
+	ti.addKey(enc)
+	ti.addKey(map[string]string{"kty": "oct", "kid": "oct-1", "k": "c2VjcmV0"})
+
+	for kid, want := range map[string]bool{"rsa-1": true, "ec-1": true, "ec-bad": false, "rsa-enc": false, "oct-1": false, "": false} {
+		p.keys.fetched = time.Time{}
+		_, err := p.keys.get(ctx, p, kid)
+		if got := err == nil; got != want {
+			t.Errorf("get(%q): got %v, want found %v", kid, err, want)
+		}
+	}
+
+	// Without a kid, the only key in the set is used.
+	ti.mu.Lock()
+	ti.keys = ti.keys[:1]
+	ti.mu.Unlock()
+	p.keys.fetched = time.Time{}
+	p.keys.keys = nil
+	key, err := p.keys.get(ctx, p, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(*rsa.PublicKey); !ok {
+		t.Errorf("got %T, want the RSA key", key)
+	}
+}
@@ -0,0 +1,158 @@
+// Package openid implements the relying-party side of OpenID 2.0 as used by
+// Steam: a checkid_setup redirect with identifier_select, and verification of
+// the positive assertion by direct check_authentication with the provider.
+// Associations are not supported, as Steam does not need them.
+package openid
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	Namespace        = "http://specs.openid.net/auth/2.0"
+	identifierSelect = Namespace + "/identifier_select"
+)
+
+var (
+	ErrCancelled       = errors.New("openid: authentication cancelled by the user")
+	ErrInvalidResponse = errors.New("openid: invalid authentication response")
+	ErrNotVerified     = errors.New("openid: provider did not confirm the assertion")
+)
+
+// steamIDRX extracts the Steam ID from a claimed identifier such as
+// https://steamcommunity.com/openid/id/76561197960287930.
+var steamIDRX = regexp.MustCompile(`^/openid/id/(7656119\d{10})$`)
+
+type Provider struct {
+	// Endpoint is the provider's OP endpoint URL, for example
+	// https://steamcommunity.com/openid/login.
+	Endpoint string
+	Client   *http.Client
+}
+
+func New(endpoint string) *Provider {
+	return &Provider{
+		Endpoint: endpoint,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthURL returns the URL to send the user to. The provider redirects back to
+// returnTo, which must lie within realm.
+func (p *Provider) AuthURL(returnTo, realm string) string {
+	q := url.Values{}
+	q.Set("openid.ns", Namespace)
+	q.Set("openid.mode", "checkid_setup")
+	q.Set("openid.return_to", returnTo)
+	q.Set("openid.realm", realm)
+	q.Set("openid.identity", identifierSelect)
+	q.Set("openid.claimed_id", identifierSelect)
+	sep := "?"
+	if strings.Contains(p.Endpoint, "?") {
+		sep = "&"
+	}
+	return p.Endpoint + sep + q.Encode()
+}
+
+// Verify checks the assertion in the callback query and returns the claimed
+// identifier. returnTo must be the exact URL passed to AuthURL.
+func (p *Provider) Verify(ctx context.Context, query url.Values, returnTo string) (string, error) {
+	switch query.Get("openid.mode") {
+	case "id_res":
+	case "cancel":
+		return "", ErrCancelled
+	default:
+		return "", ErrInvalidResponse
+	}
+	if query.Get("openid.ns") != Namespace ||
+		query.Get("openid.op_endpoint") != p.Endpoint ||
+		query.Get("openid.return_to") != returnTo {
+		return "", ErrInvalidResponse
+	}
+	claimedID := query.Get("openid.claimed_id")
+	if claimedID == "" || query.Get("openid.identity") != claimedID {
+		return "", ErrInvalidResponse
+	}
+	// The fields relied on above must be covered by the signature, otherwise
+	// a valid signature says nothing about them.
+	signed := make(map[string]bool)
+	for _, field := range strings.Split(query.Get("openid.signed"), ",") {
+		signed[field] = true
+	}
+	for _, field := range []string{"op_endpoint", "return_to", "response_nonce", "claimed_id", "identity"} {
+		if !signed[field] {
+			return "", ErrInvalidResponse
+		}
+	}
+	form := url.Values{}
+	for key, values := range query {
+		if strings.HasPrefix(key, "openid.") {
+			form[key] = values
+		}
+	}
+	form.Set("openid.mode", "check_authentication")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("openid: check_authentication returned %s", res.Status)
+	}
+	values, err := parseKeyValue(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if values["is_valid"] != "true" {
+		return "", ErrNotVerified
+	}
+	return claimedID, nil
+}
+
+// SteamID returns the 64-bit Steam ID in a claimed identifier, which must be
+// on the same host as the provider endpoint.
+func (p *Provider) SteamID(claimedID string) (string, error) {
+	endpoint, err := url.Parse(p.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	claimed, err := url.Parse(claimedID)
+	if err != nil {
+		return "", ErrInvalidResponse
+	}
+	if claimed.Scheme != endpoint.Scheme || claimed.Host != endpoint.Host {
+		return "", ErrInvalidResponse
+	}
+	m := steamIDRX.FindStringSubmatch(claimed.Path)
+	if m == nil {
+		return "", ErrInvalidResponse
+	}
+	return m[1], nil
+}
+
+// parseKeyValue reads the key:value line format used for direct responses.
+func parseKeyValue(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok {
+			values[key] = value
+		}
+	}
+	return values, scanner.Err()
+}
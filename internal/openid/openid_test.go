@@ -0,0 +1,166 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testReturnTo = "http://localhost:4000/v1/auth/steam/callback?state=abc"
+
+// testProvider answers every check_authentication with isValid, counting the
+// requests.
+type testProvider struct {
+	*httptest.Server
+	isValid bool
+
+	mu     sync.Mutex
+	checks int
+}
+
+func newTestProvider(t *testing.T, isValid bool) (*testProvider, *Provider) {
+	t.Helper()
+	tp := &testProvider{isValid: isValid}
+	tp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.PostFormValue("openid.mode") != "check_authentication" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		tp.mu.Lock()
+		tp.checks++
+		tp.mu.Unlock()
+		fmt.Fprintf(w, "ns:%s\nis_valid:%t\n", Namespace, tp.isValid)
+	}))
+	t.Cleanup(tp.Close)
+	p := New(tp.URL + "/openid/login")
+	p.Client = tp.Client()
+	return tp, p
+}
+
+func (tp *testProvider) checkCount() int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.checks
+}
+
+// assertion returns a positive assertion from p for a Steam ID.
+func assertion(p *Provider) url.Values {
+	claimedID := strings.TrimSuffix(p.Endpoint, "/login") + "/id/76561197960287930"
+	return url.Values{
+		"openid.ns":             {Namespace},
+		"openid.mode":           {"id_res"},
+		"openid.op_endpoint":    {p.Endpoint},
+		"openid.claimed_id":     {claimedID},
+		"openid.identity":       {claimedID},
+		"openid.return_to":      {testReturnTo},
+		"openid.response_nonce": {"2024-01-01T00:00:00Zabcdef"},
+		"openid.assoc_handle":   {"1234567890"},
+		"openid.signed":         {"signed,op_endpoint,claimed_id,identity,return_to,response_nonce,assoc_handle"},
+		"openid.sig":            {"c2lnbmF0dXJl"},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tp, p := newTestProvider(t, true)
+	claimedID, err := p.Verify(context.Background(), assertion(p), testReturnTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steamID, err := p.SteamID(claimedID)
+	if err != nil || steamID != "76561197960287930" {
+		t.Errorf("SteamID(%q) = %q, %v", claimedID, steamID, err)
+	}
+	if n := tp.checkCount(); n != 1 {
+		t.Errorf("checked %d times, want 1", n)
+	}
+}
+
+// TestVerifyInvalid checks that responses that cannot be trusted are refused
+// without asking the provider, as its answer would only cover what is signed.
+func TestVerifyInvalid(t *testing.T) {
+	tp, p := newTestProvider(t, true)
+	tests := map[string]func(q url.Values){
+		"no mode":         func(q url.Values) { q.Del("openid.mode") },
+		"setup_needed":    func(q url.Values) { q.Set("openid.mode", "setup_needed") },
+		"other namespace": func(q url.Values) { q.Set("openid.ns", "http://openid.net/signon/1.1") },
+		"other endpoint":  func(q url.Values) { q.Set("openid.op_endpoint", "https://evil.example.com/openid/login") },
+		"other return_to": func(q url.Values) {
+			q.Set("openid.return_to", "http://localhost:4000/v1/auth/steam/callback?state=xyz")
+		},
+		"no claimed_id":    func(q url.Values) { q.Del("openid.claimed_id") },
+		"identity differs": func(q url.Values) { q.Set("openid.identity", q.Get("openid.claimed_id")+"0") },
+		"nothing signed":   func(q url.Values) { q.Del("openid.signed") },
+		"signed names prefixed": func(q url.Values) {
+			q.Set("openid.signed", "openid.op_endpoint,openid.claimed_id,openid.identity,openid.return_to,openid.response_nonce")
+		},
+	}
+	for _, field := range []string{"op_endpoint", "return_to", "response_nonce", "claimed_id", "identity"} {
+		field := field
+		tests["unsigned "+field] = func(q url.Values) {
+			var rest []string
+			for _, f := range strings.Split(q.Get("openid.signed"), ",") {
+				if f != field {
+					rest = append(rest, f)
+				}
+			}
+			q.Set("openid.signed", strings.Join(rest, ","))
+		}
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			q := assertion(p)
+			change(q)
+			_, err := p.Verify(context.Background(), q, testReturnTo)
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("got %v, want %v", err, ErrInvalidResponse)
+			}
+		})
+	}
+	if n := tp.checkCount(); n != 0 {
+		t.Errorf("checked %d times, want 0", n)
+	}
+}
+
+func TestVerifyCancelled(t *testing.T) {
+	_, p := newTestProvider(t, true)
+	q := url.Values{"openid.ns": {Namespace}, "openid.mode": {"cancel"}}
+	_, err := p.Verify(context.Background(), q, testReturnTo)
+	if !errors.Is(err, ErrCancelled) {
+		t.Errorf("got %v, want %v", err, ErrCancelled)
+	}
+}
+
+func TestVerifyNotConfirmed(t *testing.T) {
+	tp, p := newTestProvider(t, false)
+	_, err := p.Verify(context.Background(), assertion(p), testReturnTo)
+	if !errors.Is(err, ErrNotVerified) {
+		t.Errorf("got %v, want %v", err, ErrNotVerified)
+	}
+	if n := tp.checkCount(); n != 1 {
+		t.Errorf("checked %d times, want 1", n)
+	}
+}
+
+func TestSteamID(t *testing.T) {
+	p := New("https://steamcommunity.com/openid/login")
+	tests := map[string]string{
+		"https://steamcommunity.com/openid/id/76561197960287930":       "76561197960287930",
+		"http://steamcommunity.com/openid/id/76561197960287930":        "",
+		"https://evil.example.com/openid/id/76561197960287930":         "",
+		"https://steamcommunity.com/openid/id/12345":                   "",
+		"https://steamcommunity.com/openid/id/76561197960287930/extra": "",
+		"https://steamcommunity.com/profiles/76561197960287930":        "",
+	}
+	for claimedID, want := range tests {
+		got, err := p.SteamID(claimedID)
+		if got != want || (want == "") != (err != nil) {
+			t.Errorf("SteamID(%q) = %q, %v, want %q", claimedID, got, err, want)
+		}
+	}
+}
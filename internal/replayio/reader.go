@@ -0,0 +1,189 @@
+package replayio
+
+import (
+	"DotaReplays/internal/data"
+	"DotaReplays/internal/i18n"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HeroSeparator separates the heroes inside the single CSV heroes column.
+const HeroSeparator = "|"
+
+const maxLineBytes = 1_048_576
+
+// Record is a single decoded row. Err is set when the row itself is malformed;
+// the rest of the input can still be read.
+type Record struct {
+	Line   int
+	Replay *data.Replay
+	Err    error
+}
+
+type Reader interface {
+	// Read returns the next record, or io.EOF once the input is exhausted. Any
+	// other error means the input as a whole cannot be read any further.
+	Read() (*Record, error)
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func NewCSVReader(r io.Reader) Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+	return &csvReader{r: cr}
+}
+
+func (c *csvReader) readHeader() error {
+	header, err := c.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return i18n.Errorf("csv_header_missing")
+		}
+		return err
+	}
+	c.line++
+	c.columns = make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "title", "year", "runtime", "heroes", "patch":
+		default:
+			return i18n.Errorf("csv_unknown_column", name)
+		}
+		if _, exists := c.columns[name]; exists {
+			return i18n.Errorf("csv_duplicate_column", name)
+		}
+		c.columns[name] = i
+	}
+	for _, name := range []string{"title", "year", "runtime", "heroes"} {
+		if _, exists := c.columns[name]; !exists {
+			return i18n.Errorf("csv_missing_column", name)
+		}
+	}
+	return nil
+}
+
+func (c *csvReader) Read() (*Record, error) {
+	if c.columns == nil {
+		err := c.readHeader()
+		if err != nil {
+			return nil, err
+		}
+	}
+	fields, err := c.r.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			c.line = parseError.StartLine
+			return &Record{Line: c.line, Err: parseError.Err}, nil
+		}
+		return nil, err
+	}
+	c.line, _ = c.r.FieldPos(0)
+	record := &Record{Line: c.line}
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+	if len(fields) != len(c.columns) {
+		record.Err = i18n.Errorf("csv_field_count", len(fields), len(c.columns))
+		return record, nil
+	}
+	replay := &data.Replay{
+		Title: field("title"),
+		Patch: field("patch"),
+	}
+	if s := field("year"); s != "" {
+		year, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			record.Err = i18n.Errorf("year_integer")
+			return record, nil
+		}
+		replay.Year = int32(year)
+	}
+	if s := field("runtime"); s != "" {
+		replay.Runtime, err = data.ParseRuntime(s)
+		if err != nil {
+			record.Err = err
+			return record, nil
+		}
+	}
+	if s := field("heroes"); s != "" {
+		replay.Heroes = strings.Split(s, HeroSeparator)
+		for i := range replay.Heroes {
+			replay.Heroes[i] = strings.TrimSpace(replay.Heroes[i])
+		}
+	}
+	record.Replay = replay
+	return record, nil
+}
+
+type ndjsonReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func NewNDJSONReader(r io.Reader) Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	return &ndjsonReader{s: s}
+}
+
+func (n *ndjsonReader) Read() (*Record, error) {
+	for n.s.Scan() {
+		n.line++
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		record := &Record{Line: n.line}
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Heroes  []string     `json:"heroes"`
+			Patch   string       `json:"patch"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&input)
+		if err == nil && dec.More() {
+			err = i18n.Errorf("line_multiple_values")
+		}
+		if err != nil {
+			record.Err = err
+			return record, nil
+		}
+		record.Replay = &data.Replay{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Heroes:  input.Heroes,
+			Patch:   input.Patch,
+		}
+		return record, nil
+	}
+	if err := n.s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, i18n.Errorf("line_too_large", n.line+1, maxLineBytes)
+		}
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,77 @@
+package replayio
+
+import (
+	"DotaReplays/internal/data"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Writer interface {
+	Write(replay *data.Replay) error
+	// Flush writes any buffered data to the underlying io.Writer.
+	Flush() error
+}
+
+var csvHeader = []string{"id", "title", "year", "runtime", "heroes", "patch", "version"}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(replay *data.Replay) error {
+	if !c.wroteHeader {
+		err := c.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	return c.w.Write([]string{
+		strconv.FormatInt(replay.ID, 10),
+		replay.Title,
+		strconv.FormatInt(int64(replay.Year), 10),
+		replay.Runtime.Format(replay.RuntimeFormat()),
+		strings.Join(replay.Heroes, HeroSeparator),
+		replay.Patch,
+		strconv.FormatInt(int64(replay.Version), 10),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	if !c.wroteHeader {
+		err := c.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewNDJSONWriter(w io.Writer) Writer {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (n *ndjsonWriter) Write(replay *data.Replay) error {
+	return n.enc.Encode(replay)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.buf.Flush()
+}
@@ -0,0 +1,172 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// maxBuffered is how many finished spans are held before they are written
+// out even though no local root span has ended.
+const maxBuffered = 512
+
+// Exporter writes finished spans to w as OTLP-JSON: each line is one
+// ExportTraceServiceRequest, the body an OTLP/HTTP collector accepts, so a
+// file of them can be replayed into a collector as it is.
+type Exporter struct {
+	service string
+
+	mu    sync.Mutex
+	w     io.Writer
+	spans []*Span
+}
+
+// NewExporter returns an exporter that writes to w, naming service as the
+// service.name resource attribute.
+func NewExporter(w io.Writer, service string) *Exporter {
+	return &Exporter{w: w, service: service}
+}
+
+func (e *Exporter) add(s *Span, flush bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+	if flush || len(e.spans) >= maxBuffered {
+		e.flush()
+	}
+}
+
+// Flush writes out any spans that are still buffered.
+func (e *Exporter) Flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.flush()
+}
+
+func (e *Exporter) flush() error {
+	if len(e.spans) == 0 {
+		return nil
+	}
+	spans := make([]otlpSpan, len(e.spans))
+	for i, s := range e.spans {
+		spans[i] = s.otlp()
+	}
+	e.spans = e.spans[:0]
+	req := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{otlpAttr("service.name", e.service)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "DotaReplays/internal/trace"},
+			Spans: spans,
+		}},
+	}}}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+// The types below follow the OTLP JSON mapping: IDs are hex strings, 64-bit
+// integers are decimal strings and field names are lowerCamelCase.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func otlpAttr(key string, value any) otlpAttribute {
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := ""
+		if str, ok := value.(interface{ String() string }); ok {
+			s = str.String()
+		}
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := otlpSpan{
+		TraceID:           s.traceID.String(),
+		SpanID:            s.spanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parentID != (SpanID{}) {
+		span.ParentSpanID = s.parentID.String()
+	}
+	for _, a := range s.attributes {
+		span.Attributes = append(span.Attributes, otlpAttr(a.key, a.value))
+	}
+	if s.err != "" {
+		// STATUS_CODE_ERROR
+		span.Status = &otlpStatus{Code: 2, Message: s.err}
+	}
+	return span
+}
@@ -0,0 +1,332 @@
+// Package trace records spans in the manner of OpenTelemetry and writes them
+// out as OTLP-JSON, one export request per line, so traces can be kept in a
+// file and loaded into a collector or viewer later. Trace context is carried
+// between services in the W3C traceparent header.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind says what part a span plays, using the OTLP enum values.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span, possibly one in another service.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Span is a timed operation within a trace. A nil *Span is valid and does
+// nothing, which is what Start returns when tracing is off.
+type Span struct {
+	tracer   *Tracer
+	parent   *Span
+	traceID  TraceID
+	spanID   SpanID
+	parentID SpanID
+	kind     Kind
+	start    time.Time
+
+	mu         sync.Mutex
+	name       string
+	end        time.Time
+	attributes []attribute
+	err        string
+	ended      bool
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.traceID.String()
+}
+
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return s.spanID.String()
+}
+
+// SetName renames the span, for names that are only known once work has
+// started, such as the route an HTTP request matched.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute records a string, bool, integer or float value on the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attributes = append(s.attributes, attribute{key, value})
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed with err, if err is not nil.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and hands it to the exporter. Only the first call has
+// any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.tracer.export(s)
+}
+
+type spanContextKey struct{}
+
+type remoteContextKey struct{}
+
+// SpanFromContext returns the current span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns ctx with span as the current span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// ContextWithRemoteParent records a span from another service, such as one
+// read from a traceparent header, as the parent of the next root span.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, sc)
+}
+
+// Start starts a child of the current span in ctx, and makes it the current
+// span of the returned context. Without a current span it does nothing and
+// returns a nil span, so libraries can call it whether tracing is on or not.
+func Start(ctx context.Context, name string, kind ...Kind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(name, kind)
+	span.parent = parent
+	span.traceID = parent.traceID
+	span.parentID = parent.spanID
+	return ContextWithSpan(ctx, span), span
+}
+
+// Leave ends the current span in ctx and returns ctx with that span's parent
+// as the current span again. It suits code that does some work and then
+// hands the rest on, such as HTTP middleware calling the next handler.
+func Leave(ctx context.Context) context.Context {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return ctx
+	}
+	span.End()
+	return ContextWithSpan(ctx, span.parent)
+}
+
+// Tracer starts root spans and exports finished spans.
+type Tracer struct {
+	exporter *Exporter
+}
+
+// New returns a tracer that exports to exporter.
+func New(exporter *Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start starts a span that has no parent in this process. It continues the
+// trace of a remote parent recorded with ContextWithRemoteParent, unless that
+// parent was not sampled, in which case nothing is traced. A nil Tracer
+// traces nothing.
+func (t *Tracer) Start(ctx context.Context, name string, kind ...Kind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := t.newSpan(name, kind)
+	if remote, ok := ctx.Value(remoteContextKey{}).(SpanContext); ok {
+		if !remote.Sampled {
+			return ctx, nil
+		}
+		span.traceID = remote.TraceID
+		span.parentID = remote.SpanID
+	} else {
+		span.traceID = newTraceID()
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) newSpan(name string, kind []Kind) *Span {
+	span := &Span{
+		tracer: t,
+		spanID: newSpanID(),
+		kind:   KindInternal,
+		start:  time.Now(),
+		name:   name,
+	}
+	if len(kind) > 0 {
+		span.kind = kind[0]
+	}
+	return span
+}
+
+func (t *Tracer) export(s *Span) {
+	// A span whose parent is in another process, or has none, is the local
+	// root, and the end of a request or job is a good time to write out.
+	t.exporter.add(s, s.parent == nil)
+}
+
+// Flush writes out any spans that are still buffered.
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.Flush()
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms; fall back to the
+		// clock rather than give every span the same ID.
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(time.Now().UnixNano()))
+	}
+}
+
+// ParseTraceparent reads a W3C traceparent header such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func ParseTraceparent(header string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	// Version 00 has exactly four fields; later versions may add more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 || strings.ToLower(parts[1]) != parts[1] {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != 8 || strings.ToLower(parts[2]) != parts[2] {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	if sc.TraceID == (TraceID{}) || sc.SpanID == (SpanID{}) {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// Traceparent returns the traceparent header value naming span as the parent.
+func Traceparent(span *Span) string {
+	return fmt.Sprintf("00-%s-%s-01", span.traceID, span.spanID)
+}
+
+// Transport is an http.RoundTripper that traces outgoing requests as client
+// spans and passes the trace on in the traceparent header.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := Start(req.Context(), req.Method+" "+req.URL.Host, KindClient)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.End()
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.Redacted())
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", Traceparent(span))
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", res.StatusCode)
+	if res.StatusCode >= 500 {
+		span.RecordError(fmt.Errorf("%s", res.Status))
+	}
+	return res, nil
+}
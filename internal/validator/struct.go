@@ -0,0 +1,202 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RuleFunc reports whether a field value satisfies a custom rule. param is the
+// text after "=" in the tag, or "" when there is none.
+type RuleFunc func(value reflect.Value, param string) bool
+
+var (
+	rulesMu sync.RWMutex
+	rules   = make(map[string]RuleFunc)
+)
+
+// RegisterRule makes a custom rule available to `validate` struct tags. A
+// failed rule is reported with the rule name as its error code, so the name
+// should have a matching entry in the message catalogue.
+func RegisterRule(name string, fn RuleFunc) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = fn
+}
+
+// Struct checks every field of s tagged with `validate:"rule,rule=param,..."`.
+// Errors are keyed by the field's JSON name, with nested structs joined by
+// dots and slice elements indexed, for example "heroes[3]".
+//
+// Built-in rules are required, min, max, len, oneof, email and unique, plus
+// dive which applies the rules after it to each element of a slice. Fields
+// holding their zero value are only checked by required.
+func (v *Validator) Struct(s any) {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic("validator: Struct called with non-struct type " + rv.Type().String())
+	}
+	v.validateStruct(rv, "")
+}
+
+func (v *Validator) validateStruct(rv reflect.Value, prefix string) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			fv := reflect.Indirect(rv.Field(i))
+			if fv.Kind() == reflect.Struct {
+				v.validateStruct(fv, prefix)
+			}
+			continue
+		}
+		key := fieldName(field)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		var fieldRules []string
+		if tag != "" {
+			fieldRules = strings.Split(tag, ",")
+		}
+		v.validateValue(rv.Field(i), key, fieldRules)
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (v *Validator) validateValue(fv reflect.Value, key string, fieldRules []string) {
+	for i, rule := range fieldRules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if fv.IsZero() {
+				v.AddError(key, "required")
+				return
+			}
+			continue
+		case "dive":
+			if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+				for j := 0; j < fv.Len(); j++ {
+					v.validateValue(fv.Index(j), fmt.Sprintf("%s[%d]", key, j), fieldRules[i+1:])
+				}
+			}
+			return
+		}
+		if fv.IsZero() {
+			return
+		}
+		if code, args, ok := applyRule(fv, name, param); !ok {
+			v.AddError(key, code, args...)
+		}
+	}
+	inner := reflect.Indirect(fv)
+	if inner.Kind() == reflect.Struct && inner.Type() != timeType {
+		v.validateStruct(inner, key)
+	}
+}
+
+func applyRule(fv reflect.Value, name, param string) (string, []any, bool) {
+	fv = reflect.Indirect(fv)
+	switch name {
+	case "min", "max", "len":
+		return applyBound(fv, name, param)
+	case "oneof":
+		options := strings.Fields(param)
+		return "oneof", []any{strings.Join(options, ", ")}, PermittedValue(fmt.Sprint(fv.Interface()), options...)
+	case "email":
+		return "email", nil, fv.Kind() == reflect.String && IsEmail(fv.String())
+	case "unique":
+		seen := make(map[any]bool)
+		for i := 0; i < fv.Len(); i++ {
+			item := fv.Index(i).Interface()
+			if seen[item] {
+				return "unique", nil, false
+			}
+			seen[item] = true
+		}
+		return "unique", nil, true
+	}
+	rulesMu.RLock()
+	fn, ok := rules[name]
+	rulesMu.RUnlock()
+	if !ok {
+		panic("validator: unknown rule " + name)
+	}
+	var args []any
+	if param != "" {
+		args = []any{param}
+	}
+	return name, args, fn(fv, param)
+}
+
+// applyBound checks min, max and len. Strings are measured in bytes, slices and
+// maps by their number of elements and numbers by their value.
+func applyBound(fv reflect.Value, name, param string) (string, []any, bool) {
+	switch fv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			panic("validator: invalid " + name + " parameter " + param)
+		}
+		unit := "items"
+		if fv.Kind() == reflect.String {
+			unit = "bytes"
+		}
+		code := name + "_" + unit
+		switch name {
+		case "min":
+			return code, []any{n}, fv.Len() >= n
+		case "max":
+			return code, []any{n}, fv.Len() <= n
+		default:
+			return code, []any{n}, fv.Len() == n
+		}
+	}
+	bound, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validator: invalid " + name + " parameter " + param)
+	}
+	var value float64
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		value = fv.Float()
+	default:
+		panic("validator: " + name + " is not supported for " + fv.Type().String())
+	}
+	switch name {
+	case "min":
+		return "min_value", []any{param}, value >= bound
+	case "max":
+		return "max_value", []any{param}, value <= bound
+	default:
+		return "len_value", []any{param}, value == bound
+	}
+}
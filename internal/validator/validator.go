@@ -5,30 +5,42 @@ import (
 )
 
 var (
-	EmailRX = regexp.MustCompile("")
+	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
+// Error is a failed check. Code identifies the message in the i18n catalogue
+// and Args fills in any placeholders it has.
+type Error struct {
+	Code string
+	Args []any
+}
+
 type Validator struct {
-	Errors map[string]string
+	Errors map[string][]Error
 }
 
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{Errors: make(map[string][]Error)}
 }
 
 func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-func (v *Validator) AddError(key, message string) {
-	if _, exists := v.Errors[key]; !exists {
-		v.Errors[key] = message
+// AddError records an error against key. A key can hold several errors, but
+// the same code is only recorded once.
+func (v *Validator) AddError(key, code string, args ...any) {
+	for _, e := range v.Errors[key] {
+		if e.Code == code {
+			return
+		}
 	}
+	v.Errors[key] = append(v.Errors[key], Error{Code: code, Args: args})
 }
 
-func (v *Validator) Check(ok bool, key, message string) {
+func (v *Validator) Check(ok bool, key, code string, args ...any) {
 	if !ok {
-		v.AddError(key, message)
+		v.AddError(key, code, args...)
 	}
 }
 
@@ -45,6 +57,12 @@ func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
 
+// IsEmail reports whether value looks like an RFC 5322 addr-spec, without
+// quoted local parts or address literals, and fits in an SMTP path.
+func IsEmail(value string) bool {
+	return len(value) <= 254 && Matches(value, EmailRX)
+}
+
 func Unique[T comparable](values []T) bool {
 	uniqueValues := make(map[T]bool)
 	for _, value := range values {
@@ -1,3 +1,3 @@
-ALTER TABLE "DotaReplays".public.replays DROP CONSTRAINT IF EXISTS replays_runtime_check;
-ALTER TABLE "DotaReplays".public.replays DROP CONSTRAINT IF EXISTS replays_year_check;
-ALTER TABLE "DotaReplays".public.replays DROP CONSTRAINT IF EXISTS heroes_length_check;
+ALTER TABLE replays DROP CONSTRAINT IF EXISTS replays_runtime_check;
+ALTER TABLE replays DROP CONSTRAINT IF EXISTS replays_year_check;
+ALTER TABLE replays DROP CONSTRAINT IF EXISTS heroes_length_check;
@@ -10,5 +10,5 @@ PRIMARY KEY (user_id, permission_id)
 -- Add the two permissions to the table.
 INSERT INTO permissions (code)
 VALUES
-    ('movies:read'),
-    ('movies:write');
\ No newline at end of file
+    ('replays:read'),
+    ('replays:write');
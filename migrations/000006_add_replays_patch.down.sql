@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS replays_heroes_idx;
+ALTER TABLE replays DROP COLUMN IF EXISTS patch;
@@ -0,0 +1,2 @@
+ALTER TABLE replays ADD COLUMN IF NOT EXISTS patch text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS replays_heroes_idx ON replays USING GIN (heroes);
@@ -0,0 +1,2 @@
+COMMENT ON COLUMN replays.runtime IS NULL;
+UPDATE replays SET runtime = runtime / 60;
@@ -0,0 +1,2 @@
+UPDATE replays SET runtime = runtime * 60;
+COMMENT ON COLUMN replays.runtime IS 'length of the replay in seconds';
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'admin:jobs';
+DROP TABLE IF EXISTS jobs;
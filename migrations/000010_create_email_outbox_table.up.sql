@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id bigserial PRIMARY KEY,
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    recipient text NOT NULL,
+    locale text NOT NULL DEFAULT '',
+    template text NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    sent_at timestamp(0) with time zone
+);
+CREATE INDEX IF NOT EXISTS email_outbox_user_id_idx ON email_outbox (user_id, template, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS steam_id;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
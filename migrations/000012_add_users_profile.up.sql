@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url text NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS steam_id text NOT NULL DEFAULT '';
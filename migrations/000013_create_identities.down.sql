@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS auth_requests;
+DROP TABLE IF EXISTS identities;
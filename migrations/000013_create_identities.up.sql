@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS identities (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS identities_user_id_idx ON identities (user_id);
+CREATE TABLE IF NOT EXISTS auth_requests (
+    state_hash bytea PRIMARY KEY,
+    provider text NOT NULL,
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    redirect_uri text NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
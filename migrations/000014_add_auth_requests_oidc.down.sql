@@ -0,0 +1,2 @@
+ALTER TABLE auth_requests DROP COLUMN IF EXISTS code_verifier;
+ALTER TABLE auth_requests DROP COLUMN IF EXISTS nonce;
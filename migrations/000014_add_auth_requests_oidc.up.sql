@@ -0,0 +1,2 @@
+ALTER TABLE auth_requests ADD COLUMN IF NOT EXISTS nonce text NOT NULL DEFAULT '';
+ALTER TABLE auth_requests ADD COLUMN IF NOT EXISTS code_verifier text NOT NULL DEFAULT '';
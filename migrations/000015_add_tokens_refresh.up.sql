@@ -0,0 +1,3 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family text NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family) WHERE family <> '';
@@ -0,0 +1 @@
+-- The movies:* codes were never checked by the API, so they are not restored.
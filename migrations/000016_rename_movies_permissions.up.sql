@@ -0,0 +1,15 @@
+-- Databases migrated before 000005 was corrected to seed replays:* still
+-- have the movies:* codes, which no route checks. Rename them, or drop them
+-- where the replays code already exists, moving their users over first.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT up.user_id, r.id
+FROM users_permissions up
+INNER JOIN permissions m ON m.id = up.permission_id
+INNER JOIN permissions r ON r.code = replace(m.code, 'movies:', 'replays:')
+WHERE m.code IN ('movies:read', 'movies:write')
+ON CONFLICT DO NOTHING;
+DELETE FROM permissions m
+WHERE m.code IN ('movies:read', 'movies:write')
+AND EXISTS (SELECT 1 FROM permissions r WHERE r.code = replace(m.code, 'movies:', 'replays:'));
+UPDATE permissions SET code = replace(code, 'movies:', 'replays:')
+WHERE code IN ('movies:read', 'movies:write');